@@ -1,12 +1,23 @@
 package ast
 
-import "mibk.dev/phpdoc"
+import (
+	"mibk.dev/php/token"
+	"mibk.dev/phpdoc"
+)
 
+// A File represents a PHP file. View templates might start with
+// inline HTML, in which case the file has no Pragmas, Namespace or
+// UseStmts, and Stmts start with an *InlineHTMLStmt or an *EchoTagStmt.
 type File struct {
-	Pragmas   []*Pragma
-	Namespace *Name
-	UseStmts  []*UseStmt
-	Stmts     []Stmt
+	BOM        bool // starts with a byte order mark
+	CRLF       bool // lines mostly end with \r\n
+	OneLinePHP bool // the PHP code up to the first ?> is on one line
+	Pragmas    []*Pragma
+	Namespace  *Name
+	UseStmts   []*UseStmt
+	Stmts      []Stmt
+	Comments   CommentMap // comments that are not statements or members
+	Spans      SpanMap    // where the statements and members are in the source
 }
 
 // TODO: Pragma.X Expr?
@@ -19,27 +30,36 @@ type Pragma struct {
 type UseStmt struct {
 	Name  *Name
 	Alias string // or ""
+
+	// Uses of traits in classes might list more traits and adapt
+	// them (use A, B { A::f insteadof B; }).
+	Others      []*Name
+	Adaptations *BlockStmt // or nil
 }
 
 type Decl interface{ doc() *phpdoc.Block }
 
 type ConstDecl struct {
 	Doc     *phpdoc.Block // or nil
+	Type    *Type         // or nil; valid for class constants
 	Name    string
 	X       Expr
 	Comment string // or ""
 }
 
 type VarDecl struct {
-	Doc     *phpdoc.Block // or nil
-	Name    string
-	Static  bool // valid for class props
-	X       Expr
-	Comment string // or ""
+	Doc      *phpdoc.Block // or nil
+	Name     string
+	Static   bool  // valid for class props
+	Readonly bool  // valid for class props
+	Type     *Type // or nil; valid for class props
+	X        Expr
+	Comment  string // or ""
 }
 
 type FuncDecl struct {
 	Doc    *phpdoc.Block // or nil
+	Attrs  []*AttrGroup
 	Name   string
 	Static bool // valid for methods
 	Params []*Param
@@ -48,6 +68,9 @@ type FuncDecl struct {
 }
 
 type Param struct {
+	Attrs    []*AttrGroup
+	Vis      Vis   // promoted constructor params have visibility
+	Readonly bool  // valid for promoted constructor params
 	Type     *Type // or nil
 	ByRef    bool  // pass by reference
 	Variadic bool
@@ -59,9 +82,11 @@ type Param struct {
 
 type ClassDecl struct {
 	Doc        *phpdoc.Block // or nil
+	Attrs      []*AttrGroup
 	Name       string
 	Abstract   bool
 	Final      bool
+	Readonly   bool
 	Extends    *Name // or nil
 	Implements []*Name
 	Traits     []*UseStmt
@@ -70,6 +95,7 @@ type ClassDecl struct {
 
 type InterfaceDecl struct {
 	Doc     *phpdoc.Block // or nil
+	Attrs   []*AttrGroup
 	Name    string
 	Extends *Name // or nil
 	Members []Member
@@ -77,16 +103,39 @@ type InterfaceDecl struct {
 
 type TraitDecl struct {
 	Doc     *phpdoc.Block // or nil
+	Attrs   []*AttrGroup
 	Name    string
 	Members []Member
 }
 
+// An EnumDecl represents an enumeration. Backed enums have a Type.
+type EnumDecl struct {
+	Doc        *phpdoc.Block // or nil
+	Attrs      []*AttrGroup
+	Name       string
+	Type       *Type // or nil
+	Implements []*Name
+	Traits     []*UseStmt
+	Members    []Member
+}
+
+// An EnumCase represents a case of an enumeration. The cases of
+// backed enums have a value.
+type EnumCase struct {
+	Doc     *phpdoc.Block // or nil
+	Name    string
+	X       Expr   // or nil
+	Comment string // or ""
+}
+
 func (d *ConstDecl) doc() *phpdoc.Block     { return d.Doc }
 func (d *VarDecl) doc() *phpdoc.Block       { return d.Doc }
 func (d *FuncDecl) doc() *phpdoc.Block      { return d.Doc }
 func (d *ClassDecl) doc() *phpdoc.Block     { return d.Doc }
 func (d *InterfaceDecl) doc() *phpdoc.Block { return d.Doc }
 func (d *TraitDecl) doc() *phpdoc.Block     { return d.Doc }
+func (d *EnumDecl) doc() *phpdoc.Block      { return d.Doc }
+func (d *EnumCase) doc() *phpdoc.Block      { return d.Doc }
 
 type Member interface{}
 
@@ -100,9 +149,18 @@ const (
 )
 
 type ClassMemberDecl struct {
-	Doc  *phpdoc.Block // or nil
-	Vis  Vis
-	Decl Decl
+	Doc   *phpdoc.Block // or nil
+	Attrs []*AttrGroup
+	Vis   Vis
+	Decl  Decl
+}
+
+// An AttrGroup represents a group of attributes (e.g. #[A, B(1)]).
+// Each attribute is a name, which might be followed by arguments.
+// Attributes of closures and anonymous classes are elements of
+// UnknownExprs.
+type AttrGroup struct {
+	List []Expr
 }
 
 type Stmt interface{}
@@ -111,26 +169,93 @@ type CommentStmt struct {
 	Text string
 }
 
+// A Comment represents a single //-style, #-style or /*-style comment.
+type Comment struct {
+	Text string
+}
+
+// A CommentGroup represents a sequence of comments with no other
+// tokens and no blank lines between them.
+type CommentGroup struct {
+	List []*Comment
+}
+
+// Comments holds the comments associated with a node.
+type Comments struct {
+	Leading  []*CommentGroup // before the node
+	Trailing *CommentGroup   // after the node on the same line, or nil
+}
+
+// A CommentMap maps nodes to their comments. It holds the comments
+// the grammar has no place for, e.g. the ones in parameter lists,
+// before else or catch, or in class headers. (Comments between
+// statements and members are CommentStmts, and the ones within
+// unknown expressions are kept as their elements.) A comment is
+// associated with the nearest node the parser keeps track of:
+// declarations, parameters, names, blocks, catch clauses, pragmas,
+// use statements and the items of constant expressions.
+type CommentMap map[interface{}]*Comments
+
+// A Span is the part of the source a node was parsed from. It starts
+// with the node's doc comment or first token and ends after its last
+// token or the last comment that belongs to it.
+type Span struct {
+	Start, End token.Pos // End is exclusive
+}
+
+// A SpanMap maps the items of lists to their spans: the statements
+// (including the ones in blocks), class members, pragmas and use
+// statements. Blank lines have no spans.
+type SpanMap map[interface{}]Span
+
+// A BlankLine represents one or more blank lines between statements
+// or members. It's both a Stmt and a Member.
+type BlankLine struct{}
+
+// An InlineHTMLStmt represents text outside of PHP tags. The text is
+// kept as it is, including the newline that directly follows ?>.
+type InlineHTMLStmt struct {
+	Text       string
+	OneLinePHP bool // the PHP code that follows, up to the next ?>, is on one line
+}
+
+// An EchoTagStmt represents a short echo tag (<?= X ?>).
+type EchoTagStmt struct {
+	X          Expr
+	OneLinePHP bool // like in InlineHTMLStmt
+}
+
+// A HaltCompilerStmt represents a __halt_compiler(); call. The data
+// that follows it (e.g. the content of a PHAR archive) is kept intact.
+type HaltCompilerStmt struct {
+	Data string
+}
+
 type UnknownStmt struct {
 	Doc     *phpdoc.Block // or nil
 	X       Expr
 	Body    *BlockStmt
+	Alt     bool   // the body is in the alternative syntax (e.g. endforeach)
+	While   Expr   // the condition of do-while statements, or nil
 	Comment string // or ""
 }
 
 type BlockStmt struct {
-	List []Stmt
+	List    []Stmt
+	Comment string // on the line of the opening brace, or ""
 }
 
 type IfStmt struct {
 	Cond Expr // or nil
 	Body Stmt
 	Else Stmt // or nil
+	Alt  bool // the alternative syntax (if (…): … endif;)
 }
 
 type SwitchStmt struct {
 	Tag  Expr
 	Body Stmt
+	Alt  bool // the alternative syntax (switch (…): … endswitch;)
 }
 
 type CaseLabel struct {
@@ -144,6 +269,7 @@ type ForStmt struct {
 	Cond Expr // or nil
 	Post Expr // or nil
 	Body Stmt
+	Alt  bool // the alternative syntax (for (…): … endfor;)
 }
 
 // TODO: Finally
@@ -151,6 +277,7 @@ type ForStmt struct {
 type TryStmt struct {
 	Body    *BlockStmt
 	Catches []*Catch
+	Finally *BlockStmt // or nil
 }
 
 type Catch struct {
@@ -169,6 +296,22 @@ type ArrayLit struct {
 	Elems []Expr
 }
 
+// A HeredocLit represents a heredoc or nowdoc string literal.
+type HeredocLit struct {
+	Label  string
+	Nowdoc bool
+
+	// Lines holds the raw body lines with the indentation of the
+	// closing identifier removed. Lines that end with \r\n keep
+	// the \r, except for the last one (the line break before the
+	// closing identifier isn't a part of the literal).
+	Lines []string
+
+	// Indented reports whether the closing identifier was indented,
+	// which allows re-indenting the literal (as of PHP 7.3).
+	Indented bool
+}
+
 // TODO: Separate type for scope?
 
 type FuncLit struct {
@@ -178,13 +321,22 @@ type FuncLit struct {
 	Body   *BlockStmt
 }
 
+// A MatchExpr represents a match expression. The arms are not parsed
+// yet.
+type MatchExpr struct {
+	Cond Expr
+	Arms *UnknownExpr // or nil
+}
+
 type UnknownExpr struct {
 	Elems []interface{}
 }
 
 type Type struct {
-	Nullable bool
-	Name     *Name
+	Nullable     bool
+	Name         *Name
+	Union        []*Name // the other types of a union type
+	Intersection []*Name // the other types of an intersection type
 }
 
 // A Name represents a (possibly qualified or fully qualified) PHP
@@ -0,0 +1,120 @@
+package ast
+
+import "mibk.dev/php/token"
+
+// A Config controls the output of Fprint. The zero Config indents
+// with tabs and puts all the braces on the same line; start with
+// one of the presets to follow a coding style.
+type Config struct {
+	LineEnding LineEnding
+
+	// If UseSpaces is set, each level of indentation is IndentWidth
+	// spaces (4 if 0) instead of a tab.
+	UseSpaces   bool
+	IndentWidth int
+
+	ClassBrace     BracePlacement // classes, interfaces, traits and enums
+	FuncBrace      BracePlacement // functions and methods
+	ClosureBrace   BracePlacement // anonymous functions
+	AnonClassBrace BracePlacement // anonymous classes
+	ControlBrace   BracePlacement // if, switch, for, try, while, …
+
+	ReturnColon ColonSpacing // spacing around ":" in return types
+	ElseIf      ElseIfStyle  // "elseif" or "else if"
+
+	// ConstCase is the case of the constants true, false and null.
+	// Keywords, casts, built-in types and the prefixes of numbers
+	// (e.g. 0x) are always lower-cased.
+	ConstCase LetterCase
+
+	// If IndentCase is set, the case labels of switch statements are
+	// indented one level deeper than the switch, and the statements
+	// that follow them two levels. Otherwise, the labels are on the
+	// level of the switch.
+	IndentCase bool
+
+	// LineWidth is the maximum width of lines (0 means no limit).
+	// Longer parameter lists, argument lists, array literals and
+	// fluent method chains are wrapped. Tabs are IndentWidth (4 if 0)
+	// columns wide.
+	LineWidth int
+
+	// If Align is set, the assignment operators of consecutive
+	// assignments, the double arrows of multi-line array literals and
+	// match arms, and the comments that end consecutive lines are
+	// aligned (the way gofmt aligns struct fields). Blank lines and
+	// lines of a different kind end an aligned section (e.g. a call
+	// ends a section of assignments), except that the comments are
+	// aligned as long as the lines end with them.
+	Align bool
+
+	// Version is the PHP version the output must work with
+	// (token.Latest if 0). Wrapped lists only end with a comma if
+	// the version allows it.
+	Version token.Version
+}
+
+// Presets. Copy them before changing the options.
+var (
+	// Mibk is the default style of Fprint.
+	Mibk = Config{
+		ClassBrace: NextLine,
+		FuncBrace:  NextLine,
+	}
+
+	// PSR12 is the style of the PSR-12 coding standard.
+	PSR12 = Config{
+		UseSpaces:   true,
+		IndentWidth: 4,
+		ClassBrace:  NextLine,
+		FuncBrace:   NextLine,
+		IndentCase:  true,
+		LineWidth:   120,
+	}
+)
+
+// A LineEnding is a sequence of characters that ends lines. The line
+// endings of literals and inline HTML are part of them, so they are
+// kept.
+type LineEnding int
+
+const (
+	AutoLineEnding LineEnding = iota // as in the file (see File.CRLF)
+	LF                               // \n
+	CRLF                             // \r\n
+)
+
+// A BracePlacement tells where to put an opening brace.
+type BracePlacement int
+
+const (
+	SameLine BracePlacement = iota // at the end of the line
+	NextLine                       // on its own line
+)
+
+// A ColonSpacing tells how to space a colon.
+type ColonSpacing int
+
+const (
+	SpaceAfterColon    ColonSpacing = iota // "): int"
+	SpaceAroundColon                       // ") : int"
+	NoSpaceAroundColon                     // "):int"
+)
+
+// An ElseIfStyle tells how to print an else clause with an if
+// statement.
+type ElseIfStyle int
+
+const (
+	JoinElseIf  ElseIfStyle = iota // "elseif"
+	SplitElseIf                    // "else if"
+)
+
+// A LetterCase tells how to case a word.
+type LetterCase int
+
+const (
+	LowerCase LetterCase = iota // "null"
+	UpperCase                   // "NULL"
+	KeepCase                    // as in the file
+)
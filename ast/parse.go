@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"unicode/utf8"
 
 	"mibk.dev/php/token"
 	"mibk.dev/phpdoc"
@@ -22,44 +23,192 @@ func (e *SyntaxError) Error() string {
 type parser struct {
 	scan *token.Scanner
 
-	err  error
-	tok  token.Token
-	prev token.Token
-	alt  *token.Token // on backup
+	err   error
+	tok   token.Token
+	space token.Token // whitespace before tok
+	prev  token.Token
+	alt   *token.Token // on backup
+
+	prevSpace, altSpace token.Token
+
+	// The comments are not tokens for the parser. They are pending
+	// until attached to a node (see leading and trailing) or turned
+	// into statements.
+	pending      []comment
+	prevPending  int       // number of pending comments before tok
+	altPending   []comment // on backup
+	comments     CommentMap
+	lastTrailing interface{} // the last node passed to trailing
+
+	// end is the end of the last token or of the last comment
+	// attached to a node.
+	end, prevEnd token.Pos
+	spans        SpanMap
+
+	features []Feature
+
+	// If segment is set, the PHP code that follows the open tag on
+	// line openLine hasn't been closed yet; see openTag.
+	segment  *bool
+	openLine int
+
+	exprEOF bool // expressions might end with EOF (see ParseExpr)
+
+	lf, crlf int // line endings counts
+}
+
+// parserMode makes the scanner skip whitespace. The parser only keeps
+// whitespace within unknown expressions (see parser.space).
+const parserMode = token.ScanComments | token.ScanDocComments | token.SkipWhitespace
+
+func newParser(r io.Reader, opts ...token.Option) *parser {
+	opts = append(opts[:len(opts):len(opts)], token.WithMode(parserMode))
+	p := &parser{scan: token.NewScanner(r, opts...)}
+	p.next() // init
+	return p
 }
 
 // Parse parses a single PHP file. If an error occurs while parsing
 // (except io errors), the returned error will be of type *SyntaxError.
-func Parse(r io.Reader) (*File, error) {
-	p := &parser{scan: token.NewScanner(r)}
-	p.next0() // init
+// The options configure the scanner, e.g. token.WithVersion makes Parse
+// report syntax not available in the given PHP version.
+func Parse(r io.Reader, opts ...token.Option) (*File, error) {
+	p := newParser(r, opts...)
 	doc := p.parseFile()
 	if p.err != nil {
 		return nil, p.err
 	}
+	// Ties go to \n.
+	doc.CRLF = p.crlf > p.lf-p.crlf
+	doc.Comments = p.comments
+	doc.Spans = p.spans
 	return doc, nil
 }
 
+// ParseExpr parses a single expression, e.g. "$a->b()". Like the other
+// functions parsing snippets of code, it expects no opening tag, and
+// the comments that aren't a part of the returned nodes (see
+// File.Comments) are dropped.
+func ParseExpr(src string, opts ...token.Option) (Expr, error) {
+	var x Expr
+	err := parseSnippet(src, opts, func(p *parser) {
+		if p.tok.Type == token.EOF {
+			p.errorf("missing expression")
+			return
+		}
+		p.exprEOF = true
+		x = p.parseExpr()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// ParseStmts parses a list of statements, which might include
+// declarations (e.g. of functions or classes).
+func ParseStmts(src string, opts ...token.Option) ([]Stmt, error) {
+	var list []Stmt
+	err := parseSnippet(src, opts, func(p *parser) { list = p.parseTopLevelStmts(nil) })
+	return list, err
+}
+
+// ParseMember parses a single member of a class, e.g. a method, or
+// a use of traits, which it returns as a *UseStmt.
+func ParseMember(src string, opts ...token.Option) (Member, error) {
+	var m Member
+	err := parseSnippet(src, opts, func(p *parser) {
+		if p.tok.Type == token.Use {
+			m = p.parseTraitUseStmt()
+		} else {
+			m = p.parseMember()
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ParseType parses a type, e.g. "?int" or "Foo|Bar".
+func ParseType(src string, opts ...token.Option) (*Type, error) {
+	var typ *Type
+	err := parseSnippet(src, opts, func(p *parser) { typ = p.parseType() })
+	return typ, err
+}
+
+// parseSnippet parses src, a snippet of PHP code, using parse, which
+// must consume all of it.
+func parseSnippet(src string, opts []token.Option, parse func(p *parser)) error {
+	opts = append(opts[:len(opts):len(opts)], token.InPHP())
+	p := newParser(strings.NewReader(src), opts...)
+	parse(p)
+	if p.tok.Type != token.EOF {
+		p.errorf("unexpected %v, expecting %v", p.tok, token.EOF)
+	}
+	return p.err
+}
+
+// blankLine reports whether there is a blank line before the current
+// token.
+func (p *parser) blankLine() bool {
+	return isBlank(p.space)
+}
+
+// countLineEndings counts the line endings in s; p.lf counts all of
+// them, p.crlf only \r\n.
+func (p *parser) countLineEndings(s string) {
+	p.lf += strings.Count(s, "\n")
+	p.crlf += strings.Count(s, "\r\n")
+}
+
 func (p *parser) backup() {
 	if p.alt != nil {
 		panic("cannot backup twice")
 	}
 	p.alt = new(token.Token)
-	*p.alt = p.tok
-	p.tok = p.prev
+	*p.alt, p.altSpace = p.tok, p.space
+	p.tok, p.space = p.prev, p.prevSpace
+	p.end = p.prevEnd
+	p.altPending = append([]comment(nil), p.pending[p.prevPending:]...)
+	p.pending = p.pending[:p.prevPending]
 }
 
-func (p *parser) next0() {
+func (p *parser) next() {
+	p.prev, p.prevSpace = p.tok, p.space
 	if p.tok.Type == token.EOF {
 		return
 	}
+	p.prevEnd, p.end = p.end, endPos(p.tok)
+	p.prevPending = len(p.pending)
 	if p.alt != nil {
-		p.tok, p.alt = *p.alt, nil
+		p.tok, p.space, p.alt = *p.alt, p.altSpace, nil
+		p.pending, p.altPending = append(p.pending, p.altPending...), nil
 		return
 	}
+	for {
+		p.scanNext()
+		if p.tok.Type != token.Comment {
+			return
+		}
+		p.pending = append(p.pending, comment{p.space, p.tok})
+	}
+}
+
+func (p *parser) scanNext() {
 	p.tok = p.scan.Next()
-	if p.tok.Type == token.EOF && p.err == nil {
-		err := p.scan.Err()
+	p.space = p.scan.Space()
+	p.countLineEndings(p.space.Text)
+	p.countLineEndings(p.tok.Text)
+	if p.tok.Type == token.CloseTag && p.segment != nil {
+		*p.segment = p.tok.Pos.Line == p.openLine
+		p.segment = nil
+	}
+	if v, what := token.MinVersion(p.tok); v > 0 {
+		p.features = append(p.features, Feature{p.tok.Pos, v, what})
+	}
+	if err := p.scan.Err(); err != nil && p.err == nil {
+		// The scanner would go on, but stop at its first error.
 		if se, ok := err.(*token.ScanError); ok {
 			// Make sure we always return *SyntaxError.
 			p.err = &SyntaxError{
@@ -67,31 +216,211 @@ func (p *parser) next0() {
 				Column: se.Pos.Column,
 				Err:    se.Err,
 			}
-		} else if err != nil {
+			p.tok.Type = token.EOF
+		} else {
 			p.errorf("scan: %v", err)
 		}
 	}
 }
 
-// next is like next0 but skips whitespace.
-func (p *parser) next() {
-	p.prev = p.tok
-	p.next0()
-	p.consume(token.Whitespace)
+// A comment is a comment that is not attached to a node yet.
+type comment struct {
+	space token.Token // whitespace before the comment
+	tok   token.Token
 }
 
-func (p *parser) expect(typ token.Type) string {
-	v := p.expect0(typ)
-	p.consume(token.Whitespace)
-	return v
+// takeComments removes the pending comments from i to j and returns
+// them.
+func (p *parser) takeComments(i, j int) []comment {
+	list := append([]comment(nil), p.pending[i:j]...)
+	p.pending = append(p.pending[:i], p.pending[j:]...)
+	if p.prevPending > j {
+		p.prevPending -= j - i
+	} else if p.prevPending > i {
+		p.prevPending = i
+	}
+	return list
+}
+
+// sameLine returns the index after the pending comments that follow
+// the previous token on the same line (the ones after p.prevPending).
+func (p *parser) sameLine() int {
+	i := p.prevPending
+	for i < len(p.pending) && !strings.Contains(p.pending[i].space.Text, "\n") {
+		i++
+	}
+	return i
+}
+
+// endsLine reports whether a newline follows the pending comments
+// before the i-th.
+func (p *parser) endsLine(i int) bool {
+	space := p.space
+	if i < len(p.pending) {
+		space = p.pending[i].space
+	}
+	return strings.Contains(space.Text, "\n")
+}
+
+// nodeComments returns the comments of node, creating them if needed.
+func (p *parser) nodeComments(node interface{}) *Comments {
+	if p.comments == nil {
+		p.comments = make(CommentMap)
+	}
+	c := p.comments[node]
+	if c == nil {
+		c = new(Comments)
+		p.comments[node] = c
+	}
+	return c
+}
+
+// leading attaches the pending comments to node as leading comments.
+// Comments that follow a comma and end the line belong to the node
+// before the comma, though.
+func (p *parser) leading(node interface{}) {
+	p.addLeading(node, p.takeLeading())
+}
+
+// takeLeading is like leading, but it returns the comments instead of
+// attaching them.
+func (p *parser) takeLeading() []comment {
+	if p.prev.Type == token.Comma && p.lastTrailing != nil {
+		if i := p.sameLine(); i > p.prevPending && p.endsLine(i) {
+			p.addTrailing(p.lastTrailing, p.takeComments(p.prevPending, i))
+		}
+	}
+	return p.takeComments(0, len(p.pending))
+}
+
+// addLeading attaches list to node before the leading comments it
+// already has.
+func (p *parser) addLeading(node interface{}, list []comment) {
+	if len(list) == 0 {
+		return
+	}
+	c := p.nodeComments(node)
+	c.Leading = append(commentGroups(list), c.Leading...)
+}
+
+// trailing attaches the pending comments on the same line as the
+// previous token (the last token of node) to node.
+func (p *parser) trailing(node interface{}) {
+	p.lastTrailing = node
+	p.addTrailing(node, p.takeComments(p.prevPending, p.sameLine()))
+}
+
+// closing attaches all the pending comments to node, which is the
+// last item of a list that's about to be closed, as trailing comments.
+func (p *parser) closing(node interface{}) {
+	p.addTrailing(node, p.takeComments(0, len(p.pending)))
+}
+
+func (p *parser) addTrailing(node interface{}, list []comment) {
+	if len(list) == 0 {
+		return
+	}
+	c := p.nodeComments(node)
+	if c.Trailing == nil {
+		c.Trailing = new(CommentGroup)
+	}
+	for _, cm := range list {
+		c.Trailing.List = append(c.Trailing.List, &Comment{cm.tok.Text})
+		p.extend(cm)
+	}
+}
+
+// extend extends the end of the current node to the end of c, which
+// was attached to it.
+func (p *parser) extend(c comment) {
+	if end := endPos(c.tok); before(p.end, end) {
+		p.end = end
+	}
+}
+
+// startPos returns the position of the first pending comment, or of
+// the current token. That's where the next node starts.
+func (p *parser) startPos() token.Pos {
+	if len(p.pending) > 0 {
+		return p.pending[0].tok.Pos
+	}
+	return p.tok.Pos
+}
+
+// span records the span of node from start to the end of the last
+// token or comment that's part of it.
+func (p *parser) span(node interface{}, start token.Pos) {
+	p.addSpan(node, Span{Start: start, End: p.end})
+}
+
+func (p *parser) addSpan(node interface{}, s Span) {
+	if p.spans == nil {
+		p.spans = make(SpanMap)
+	}
+	p.spans[node] = s
+}
+
+// endPos returns the position right after tok.
+func endPos(tok token.Token) token.Pos {
+	pos, text := tok.Pos, tok.Text
+	if i := strings.LastIndexByte(text, '\n'); i >= 0 {
+		pos.Line += strings.Count(text, "\n")
+		pos.Column, text = 1, text[i+1:]
+	}
+	pos.Column += utf8.RuneCountInString(text)
+	return pos
+}
+
+func before(a, b token.Pos) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+}
+
+// commentGroups groups the comments of list separated by blank lines.
+func commentGroups(list []comment) []*CommentGroup {
+	var groups []*CommentGroup
+	for i, c := range list {
+		if i == 0 || isBlank(c.space) {
+			groups = append(groups, new(CommentGroup))
+		}
+		g := groups[len(groups)-1]
+		g.List = append(g.List, &Comment{c.tok.Text})
+	}
+	return groups
 }
 
-func (p *parser) expect0(typ token.Type) string {
+// commentStmts turns the pending comments into statements. Blank lines
+// between them are kept, and so is one before the first comment,
+// unless first is set (i.e. the statements start a list).
+func (p *parser) commentStmts(first bool) []Stmt {
+	var list []Stmt
+	for _, c := range p.takeComments(0, len(p.pending)) {
+		if !first && isBlank(c.space) {
+			list = append(list, new(BlankLine))
+		}
+		stmt := &CommentStmt{Text: c.tok.Text}
+		p.addSpan(stmt, Span{Start: c.tok.Pos, End: endPos(c.tok)})
+		list = append(list, stmt)
+		first = false
+	}
+	return list
+}
+
+func isBlank(space token.Token) bool {
+	return strings.Count(space.Text, "\n") > 1
+}
+
+// isLineComment reports whether the comment text runs to the end of
+// the line.
+func isLineComment(text string) bool {
+	return strings.HasPrefix(text, "//") || strings.HasPrefix(text, "#")
+}
+
+func (p *parser) expect(typ token.Type) string {
 	if p.tok.Type != typ {
 		p.errorf("expecting %v, found %v", typ, p.tok)
 	}
 	text := p.tok.Text
-	p.next0()
+	p.next()
 	return text
 }
 
@@ -107,59 +436,127 @@ func (p *parser) until(typ token.Type) bool {
 	return p.tok.Type != typ && p.tok.Type != token.EOF
 }
 
-func (p *parser) consume(types ...token.Type) {
-	if len(types) == 0 {
-		panic("no token types to consume provided")
-	}
-
-	for ; len(types) > 0; types = types[1:] {
-		if p.tok.Type == types[0] {
-			p.next0()
-		}
-	}
+func (p *parser) errorf(format string, args ...interface{}) {
+	p.errorAt(p.tok.Pos, format, args...)
 }
 
-func (p *parser) errorf(format string, args ...interface{}) {
+func (p *parser) errorAt(pos token.Pos, format string, args ...interface{}) {
 	if p.err == nil {
 		p.tok.Type = token.EOF
 		se := &SyntaxError{Err: fmt.Errorf(format, args...)}
-		se.Line, se.Column = p.tok.Pos.Line, p.tok.Pos.Column
+		se.Line, se.Column = pos.Line, pos.Column
 		p.err = se
 	}
 }
 
+// requireVersion records the syntax what at pos, which was introduced
+// in v. It reports an error if the scanned PHP version is older.
+func (p *parser) requireVersion(pos token.Pos, v token.Version, what string) {
+	p.features = append(p.features, Feature{pos, v, what})
+	if p.scan.Version() < v {
+		p.errorAt(pos, "%s requires PHP %v", what, v)
+	}
+}
+
+// requireKeyword reports the syntax the keyword typ starts at tok,
+// which was scanned as an identifier because the PHP version predates
+// the keyword.
+func (p *parser) requireKeyword(tok token.Token, typ token.Type) {
+	v, what := token.MinVersion(token.Token{Type: typ})
+	p.requireVersion(tok.Pos, v, what)
+}
+
+// demoted reports whether tok is the keyword typ scanned as an
+// identifier.
+func demoted(tok token.Token, typ token.Type) bool {
+	return tok.Type == token.Ident && strings.EqualFold(tok.Text, typ.String())
+}
+
 // The syntax comments roughly follow the notation as defined at
 // https://golang.org/ref/spec#Notation.
 
-// File = "<?php"
+// File = [ bom ] "<?php"
 //
 //	{ Pragma }
 //	[ "namespace" Name ";" ]
 //	{ UseStmt }
-//	{ TopLevelStmt } .
+//	{ TopLevelStmt } |
+//	( inlineHTML | EchoTagStmt ) { TopLevelStmt } .
 func (p *parser) parseFile() *File {
 	file := new(File)
-	p.expect(token.OpenTag)
-	// TODO: Allow on other places in a file?
-	file.Pragmas = p.parsePragmas()
-	if p.got(token.Namespace) {
-		file.Namespace = p.parseName()
-		p.expect(token.Semicolon)
-	}
-	for p.tok.Type == token.Use {
-		file.UseStmts = append(file.UseStmts, p.parseUseStmt())
+	if p.tok.Type == token.BOM {
+		file.BOM = true
+		p.next()
 	}
-	for !p.got(token.EOF) {
-		file.Stmts = append(file.Stmts, p.parseTopLevelStmt())
+	switch p.tok.Type {
+	case token.InlineHTML, token.EchoTag:
+		// Templates might start with HTML.
+	case token.OpenTag:
+		p.openTag(&file.OneLinePHP)
+		if p.tok.Type == token.CloseTag {
+			// The newline right after ?> isn't part of the
+			// output, so the file starts with HTML in fact.
+			html := p.parseInlineHTMLStmt()
+			html.Text = trimNewline(html.Text)
+			file.Stmts = append(file.Stmts, html)
+			break
+		}
+		// TODO: Allow on other places in a file?
+		file.Pragmas = p.parsePragmas()
+		if p.tok.Type == token.Namespace {
+			lead := p.takeLeading()
+			p.next()
+			file.Namespace = p.parseName()
+			p.expect(token.Semicolon)
+			p.trailing(file.Namespace)
+			p.addLeading(file.Namespace, lead)
+		}
+		for p.tok.Type == token.Use {
+			start := p.startPos()
+			stmt := p.parseUseStmt()
+			p.span(stmt, start)
+			file.UseStmts = append(file.UseStmts, stmt)
+		}
+	default:
+		p.expect(token.OpenTag)
 	}
+	file.Stmts = p.parseTopLevelStmts(file.Stmts)
 	return file
 }
 
+// parseTopLevelStmts appends the statements up to the end of the file
+// to list.
+func (p *parser) parseTopLevelStmts(list []Stmt) []Stmt {
+	for {
+		list = append(list, p.commentStmts(len(list) == 0)...)
+		if p.got(token.EOF) {
+			return list
+		}
+		if len(list) > 0 && p.blankLine() {
+			list = append(list, new(BlankLine))
+		}
+		start := p.startPos()
+		stmt := p.parseTopLevelStmt()
+		p.span(stmt, start)
+		list = append(list, stmt)
+	}
+}
+
+func trimNewline(s string) string {
+	if strings.HasPrefix(s, "\r\n") {
+		return s[2:]
+	}
+	return strings.TrimPrefix(s, "\n")
+}
+
 // Pragma = "declare" "(" Name "=" BasicLit ")" ";" .
 func (p *parser) parsePragmas() []*Pragma {
 	var pragmas []*Pragma
-	for p.got(token.Declare) {
+	for p.tok.Type == token.Declare {
 		d := new(Pragma)
+		start := p.startPos()
+		p.leading(d)
+		p.next()
 		p.expect(token.Lparen)
 		d.Name = p.expect(token.Ident)
 		p.expect(token.Assign)
@@ -167,6 +564,8 @@ func (p *parser) parsePragmas() []*Pragma {
 		p.expect(token.Rparen)
 		// TODO: Also parse body?
 		p.expect(token.Semicolon)
+		p.trailing(d)
+		p.span(d, start)
 		pragmas = append(pragmas, d)
 	}
 	return pragmas
@@ -175,12 +574,35 @@ func (p *parser) parsePragmas() []*Pragma {
 // UseStmt = "use" Name [ "as" ident ] ";" .
 func (p *parser) parseUseStmt() *UseStmt {
 	stmt := new(UseStmt)
+	p.leading(stmt)
 	p.expect(token.Use)
 	stmt.Name = p.parseName()
 	if p.got(token.As) {
 		stmt.Alias = p.expect(token.Ident)
 	}
 	p.expect(token.Semicolon)
+	p.trailing(stmt)
+	return stmt
+}
+
+// TraitUseStmt = "use" Name { "," Name } ( ";" | BlockStmt ) .
+//
+// The block holds the adaptations of the traits as statements (e.g.
+// A::f insteadof B;).
+func (p *parser) parseTraitUseStmt() *UseStmt {
+	stmt := new(UseStmt)
+	p.leading(stmt)
+	p.expect(token.Use)
+	stmt.Name = p.parseName()
+	for p.got(token.Comma) {
+		stmt.Others = append(stmt.Others, p.parseName())
+	}
+	if p.tok.Type == token.Lbrace {
+		stmt.Adaptations = p.parseBlockStmt()
+	} else {
+		p.expect(token.Semicolon)
+	}
+	p.trailing(stmt)
 	return stmt
 }
 
@@ -189,83 +611,263 @@ func (p *parser) parseUseStmt() *UseStmt {
 //	FuncDecl |
 //	ClassDecl |
 //	InterfaceDecl |
+//	TraitDecl |
+//	EnumDecl |
+//	HaltCompilerStmt |
 //	Stmt .
 func (p *parser) parseTopLevelStmt() Stmt {
 	doc := p.parsePHPDoc()
+	if p.tok.Type == token.AttrStart {
+		return p.parseAttributed(doc)
+	}
 	switch p.tok.Type {
 	case token.Const:
-		return p.parseConstDecl(doc)
+		return p.parseConstDecl(doc, false)
 	case token.Function:
 		return p.parseFuncDecl(doc, false)
-	case token.Class, token.Abstract, token.Final:
+	case token.Class, token.Abstract, token.Final, token.Readonly:
 		return p.parseClassDecl(doc)
 	case token.Interface:
 		return p.parseInterfaceDecl(doc)
 	case token.Trait:
 		return p.parseTraitDecl(doc)
+	case token.Enum:
+		return p.parseEnumDecl(doc)
+	case token.HaltCompiler:
+		if doc != nil {
+			p.errorf("unexpected %v after %v", token.HaltCompiler, token.DocComment)
+		}
+		return p.parseHaltCompilerStmt()
 	default:
 		return p.parseStmt(doc)
 	}
 }
 
-// ConstDecl = "const" ident "=" Expr ";" .
-func (p *parser) parseConstDecl(doc *phpdoc.Block) *ConstDecl {
+// parseAttributed parses a declaration that starts with attributes.
+// Closures and arrow functions might start with attributes too, so
+// they are parsed as statements.
+func (p *parser) parseAttributed(doc *phpdoc.Block) Stmt {
+	attrs := p.parseAttrs()
+	var d Stmt
+	switch p.tok.Type {
+	case token.Function:
+		p.next()
+		typ := p.tok.Type
+		p.backup()
+		if typ == token.Lparen || typ == token.And {
+			return p.parseAttributedStmt(doc, attrs)
+		}
+		fn := p.parseFuncDecl(doc, false)
+		fn.Attrs = attrs
+		d = fn
+	case token.Class, token.Abstract, token.Final, token.Readonly:
+		class := p.parseClassDecl(doc)
+		class.Attrs = attrs
+		d = class
+	case token.Interface:
+		iface := p.parseInterfaceDecl(doc)
+		iface.Attrs = attrs
+		d = iface
+	case token.Trait:
+		trait := p.parseTraitDecl(doc)
+		trait.Attrs = attrs
+		d = trait
+	case token.Enum:
+		enum := p.parseEnumDecl(doc)
+		enum.Attrs = attrs
+		d = enum
+	default:
+		if p.tok.Type == token.Fn || p.tok.Type == token.Static {
+			return p.parseAttributedStmt(doc, attrs)
+		}
+		p.errorf("unexpected %v after attribute", p.tok)
+	}
+	return d
+}
+
+// parseAttributedStmt parses a statement that starts with a closure
+// or an arrow function, whose attributes have already been parsed.
+func (p *parser) parseAttributedStmt(doc *phpdoc.Block, attrs []*AttrGroup) *UnknownStmt {
+	var elems []interface{}
+	for _, g := range attrs {
+		elems = append(elems, g)
+	}
+	if p.space.Text != "" {
+		elems = append(elems, p.space)
+	}
+	stmt := p.parseUnknownStmt(doc)
+	if x, ok := stmt.X.(*UnknownExpr); ok && x != nil {
+		x.Elems = append(elems, x.Elems...)
+	}
+	return stmt
+}
+
+// Attrs     = AttrGroup { AttrGroup } .
+// AttrGroup = "#[" Attr { "," Attr } [ "," ] "]" .
+func (p *parser) parseAttrs() []*AttrGroup {
+	var list []*AttrGroup
+	for p.tok.Type == token.AttrStart {
+		list = append(list, p.parseAttrGroup())
+	}
+	return list
+}
+
+func (p *parser) parseAttrGroup() *AttrGroup {
+	g := new(AttrGroup)
+	p.expect(token.AttrStart)
+	for p.until(token.Rbrack) {
+		x := p.parseAttr()
+		if x == nil {
+			return g
+		}
+		g.List = append(g.List, x)
+		if p.tok.Type == token.Rbrack {
+			break
+		}
+		p.expect(token.Comma)
+	}
+	p.expect(token.Rbrack)
+	return g
+}
+
+// Attr = Name [ "(" Args ")" ] .
+func (p *parser) parseAttr() Expr {
+	x := new(UnknownExpr)
+	if p.tok.Type == token.Backslash {
+		x.Elems = append(x.Elems, p.tok)
+		p.next()
+	}
+	for {
+		if p.tok.Type != token.Ident {
+			p.errorf("expecting %v, found %v", token.Ident, p.tok)
+			return nil
+		}
+		x.Elems = append(x.Elems, p.tok)
+		p.next()
+		if p.tok.Type != token.Backslash {
+			break
+		}
+		x.Elems = append(x.Elems, p.tok)
+		p.next()
+	}
+	if p.tok.Type == token.Lparen && !p.parseParens(x) {
+		return nil
+	}
+	return x
+}
+
+// HaltCompilerStmt = "__halt_compiler" "(" ")" ( ";" | "?>" ) [ inlineHTML ] .
+func (p *parser) parseHaltCompilerStmt() *HaltCompilerStmt {
+	stmt := new(HaltCompilerStmt)
+	p.expect(token.HaltCompiler)
+	p.expect(token.Lparen)
+	if p.tok.Type != token.Rparen {
+		p.errorf("unexpected %v, expecting %v", p.tok, token.Rparen)
+		return stmt
+	}
+	p.next()
+	closeTag := p.tok.Type == token.CloseTag
+	if !closeTag {
+		p.expect(token.Semicolon)
+	} else {
+		p.next()
+	}
+	// The data that follows is scanned as inline HTML, so it isn't
+	// skipped as whitespace.
+	if p.tok.Type == token.InlineHTML {
+		stmt.Data = p.tok.Text
+		if closeTag {
+			// The newline right after ?> isn't part of the data.
+			stmt.Data = trimNewline(stmt.Data)
+		}
+		p.next()
+	}
+	return stmt
+}
+
+// ConstDecl = "const" [ Type ] Ident "=" Expr ";" .
+//
+// Only class constants might have a Type.
+func (p *parser) parseConstDecl(doc *phpdoc.Block, member bool) *ConstDecl {
 	c := new(ConstDecl)
 	c.Doc = doc
+	p.leading(c)
 	p.expect(token.Const)
-	if p.tok.Type.IsKeyword() {
-		c.Name = p.tok.Text
-		p.next()
-	} else {
-		c.Name = p.expect(token.Ident)
+	if member && p.typedConst() {
+		pos := p.tok.Pos
+		c.Type = p.parseType()
+		p.requireVersion(pos, token.PHP83, "typed class constant")
 	}
+	c.Name = p.parseIdent()
 	p.expect(token.Assign)
 	c.X = p.parseExpr()
-	p.expect0(token.Semicolon)
+	p.expect(token.Semicolon)
 	c.Comment = p.parseOptComment()
 	return c
 }
 
+// typedConst reports whether the class constant that follows has
+// a type, i.e. whether its name isn't followed by "=".
+func (p *parser) typedConst() bool {
+	switch p.tok.Type {
+	case token.Qmark, token.Backslash:
+		return true
+	}
+	if !isIdent(p.tok) {
+		return false
+	}
+	p.next()
+	typ := p.tok.Type
+	p.backup()
+	return typ != token.Assign
+}
+
 // VarDecl = var [ "=" Expr ] ";" .
 func (p *parser) parseVarDecl(doc *phpdoc.Block, static bool) *VarDecl {
 	v := new(VarDecl)
 	v.Doc = doc
 	v.Static = static
+	p.leading(v)
 	v.Name = p.expect(token.Var)
 	if p.got(token.Assign) {
 		v.X = p.parseExpr()
 	}
-	p.expect0(token.Semicolon)
+	p.expect(token.Semicolon)
 	v.Comment = p.parseOptComment()
 	return v
 }
 
+// parseOptComment parses a comment on the same line as the previous
+// token, if there is one.
 func (p *parser) parseOptComment() string {
-	if ws := p.tok; ws.Type == token.Whitespace {
-		p.next()
-		if strings.ContainsRune(ws.Text, '\n') {
-			return ""
-		}
-	}
-	if p.tok.Type == token.Comment {
-		defer p.next()
-		return p.tok.Text
+	if i := p.prevPending; i < p.sameLine() {
+		c := p.takeComments(i, i+1)[0]
+		p.extend(c)
+		return c.tok.Text
 	}
 	return ""
 }
 
-// FuncDecl = "function" ident ParamList [ ":" Type ] BlockStmt .
+// parseEndComment is like parseOptComment, but the comment must also
+// be the last on the line.
+func (p *parser) parseEndComment() string {
+	i := p.prevPending
+	if i >= p.sameLine() || !p.endsLine(i+1) {
+		return ""
+	}
+	c := p.takeComments(i, i+1)[0]
+	p.extend(c)
+	return c.tok.Text
+}
+
+// FuncDecl = "function" Ident ParamList [ ":" Type ] BlockStmt .
 func (p *parser) parseFuncDecl(doc *phpdoc.Block, static bool) *FuncDecl {
 	fn := new(FuncDecl)
 	fn.Doc = doc
 	fn.Static = static
+	p.leading(fn)
 	p.expect(token.Function)
-	if p.tok.Type.IsKeyword() {
-		fn.Name = p.tok.Text
-		p.next()
-	} else {
-		fn.Name = p.expect(token.Ident)
-	}
+	fn.Name = p.parseIdent()
 	fn.Params = p.parseParamList()
 	if p.got(token.Colon) {
 		fn.Result = p.parseType()
@@ -280,12 +882,26 @@ func (p *parser) parseFuncDecl(doc *phpdoc.Block, static bool) *FuncDecl {
 }
 
 // ParamList = "(" [ Param { "," Param } [ "," ] ] ")" .
-// Param     = [ Type ] [ "&" ] [ "..." ] var [ "=" Lit ] .
+// Param     = [ Modifiers ] [ Type ] [ "&" ] [ "..." ] var [ "=" Lit ] .
+// Modifiers = Visibility [ "readonly" ] | "readonly" [ Visibility ] .
 func (p *parser) parseParamList() []*Param {
 	var params []*Param
 	p.expect(token.Lparen)
 	for p.until(token.Rparen) {
 		par := new(Param)
+		p.leading(par)
+		par.Attrs = p.parseAttrs()
+		p.checkReadonly()
+		if pos := p.tok.Pos; p.tok.Type == token.Readonly {
+			par.Readonly = true
+			p.next()
+			par.Vis = p.parseVisibility()
+			p.requireVersion(pos, token.PHP80, "constructor property promotion")
+		} else if par.Vis = p.parseVisibility(); par.Vis != DefaultVis {
+			par.Readonly = p.got(token.Readonly)
+			p.checkReadonly()
+			p.requireVersion(pos, token.PHP80, "constructor property promotion")
+		}
 		par.Type = p.tryParseType()
 		par.ByRef = p.got(token.And)
 		par.Variadic = p.got(token.Ellipsis)
@@ -294,19 +910,27 @@ func (p *parser) parseParamList() []*Param {
 			par.Default = p.parseConstExpr()
 		}
 		params = append(params, par)
+		p.trailing(par)
 		if p.tok.Type == token.Rparen {
 			break
 		}
+		pos := p.tok.Pos
 		p.expect(token.Comma)
+		if p.tok.Type == token.Rparen {
+			p.requireVersion(pos, token.PHP80, "trailing comma in parameter list")
+		}
+	}
+	if n := len(params); n > 0 {
+		p.closing(params[n-1])
 	}
 	p.expect(token.Rparen)
 	return params
 }
 
-// ClassDecl = [ "abstract" ] "class" ident [ "extends" Name ]
+// ClassDecl = { "abstract" | "final" | "readonly" } "class" ident [ "extends" Name ]
 //
 //	[ "implements" Name { "," Name } ]
-//	"{" { UseStmt } { ClassMember } "}" .
+//	"{" { TraitUseStmt } { ClassMember } "}" .
 func (p *parser) parseClassDecl(doc *phpdoc.Block) *ClassDecl {
 	return p.parseClassDeclaration(doc, false)
 }
@@ -314,7 +938,7 @@ func (p *parser) parseClassDecl(doc *phpdoc.Block) *ClassDecl {
 // AnonymClassDecl = "class" [ "extends" Name ]
 //
 //	[ "implements" Name { "," Name } ]
-//	"{" { UseStmt } { ClassMember } "}" .
+//	"{" { TraitUseStmt } { ClassMember } "}" .
 func (p *parser) parseAnonymClassDecl() *ClassDecl {
 	return p.parseClassDeclaration(nil, true)
 }
@@ -322,10 +946,19 @@ func (p *parser) parseAnonymClassDecl() *ClassDecl {
 func (p *parser) parseClassDeclaration(doc *phpdoc.Block, anonymous bool) *ClassDecl {
 	class := new(ClassDecl)
 	class.Doc = doc
-	class.Abstract = p.got(token.Abstract)
-	if !class.Abstract {
-		class.Final = p.got(token.Final)
+	for {
+		if pos := p.tok.Pos; p.got(token.Readonly) {
+			p.requireVersion(pos, token.PHP82, "readonly class")
+			class.Readonly = true
+		} else if !class.Final && p.got(token.Abstract) {
+			class.Abstract = true
+		} else if !class.Abstract && p.got(token.Final) {
+			class.Final = true
+		} else {
+			break
+		}
 	}
+	p.leading(class)
 	p.expect(token.Class)
 	if !anonymous {
 		class.Name = p.expect(token.Ident)
@@ -343,12 +976,9 @@ func (p *parser) parseClassDeclaration(doc *phpdoc.Block, anonymous bool) *Class
 	}
 	p.expect(token.Lbrace)
 	for p.tok.Type == token.Use {
-		class.Traits = append(class.Traits, p.parseUseStmt())
-	}
-	for p.until(token.Rbrace) {
-		m := p.parseMember()
-		class.Members = append(class.Members, m)
+		class.Traits = append(class.Traits, p.parseTraitUseStmt())
 	}
+	class.Members = p.parseMembers()
 	p.expect(token.Rbrace)
 	return class
 }
@@ -357,16 +987,14 @@ func (p *parser) parseClassDeclaration(doc *phpdoc.Block, anonymous bool) *Class
 func (p *parser) parseInterfaceDecl(doc *phpdoc.Block) *InterfaceDecl {
 	iface := new(InterfaceDecl)
 	iface.Doc = doc
+	p.leading(iface)
 	p.expect(token.Interface)
 	iface.Name = p.expect(token.Ident)
 	if p.got(token.Extends) {
 		iface.Extends = p.parseName()
 	}
 	p.expect(token.Lbrace)
-	for p.until(token.Rbrace) {
-		m := p.parseMember()
-		iface.Members = append(iface.Members, m)
-	}
+	iface.Members = p.parseMembers()
 	p.expect(token.Rbrace)
 	return iface
 }
@@ -375,56 +1003,166 @@ func (p *parser) parseInterfaceDecl(doc *phpdoc.Block) *InterfaceDecl {
 func (p *parser) parseTraitDecl(doc *phpdoc.Block) *TraitDecl {
 	trait := new(TraitDecl)
 	trait.Doc = doc
+	p.leading(trait)
 	p.expect(token.Trait)
 	trait.Name = p.expect(token.Ident)
 	p.expect(token.Lbrace)
-	for p.until(token.Rbrace) {
-		m := p.parseMember()
-		trait.Members = append(trait.Members, m)
-	}
+	trait.Members = p.parseMembers()
 	p.expect(token.Rbrace)
 	return trait
 }
 
-// ClassMember = comment |
+// EnumDecl = "enum" ident [ ":" Type ]
 //
-//	[ PHPDoc ] [ Visibility ]
-//	( ConstDecl | [ "static" ] VarDecl | [ "static" ] FuncDecl ) .
-func (p *parser) parseMember() Member {
-	if p.tok.Type == token.Comment {
-		c := &CommentStmt{Text: p.tok.Text}
-		p.next()
-		return c
+//	[ "implements" Name { "," Name } ]
+//	"{" { TraitUseStmt } { ClassMember } "}" .
+func (p *parser) parseEnumDecl(doc *phpdoc.Block) *EnumDecl {
+	enum := new(EnumDecl)
+	enum.Doc = doc
+	p.leading(enum)
+	p.expect(token.Enum)
+	enum.Name = p.expect(token.Ident)
+	if p.got(token.Colon) {
+		enum.Type = p.parseType()
 	}
-
-	m := new(ClassMemberDecl)
-	m.Doc = p.parsePHPDoc()
-	m.Vis = p.parseVisibility()
-	static := p.got(token.Static)
-	switch p.tok.Type {
-	default:
-		p.errorf("unexpected %v, expecting %v or %v", p.tok, token.Const, token.Function)
-		return nil
+	if p.got(token.Implements) {
+		for {
+			enum.Implements = append(enum.Implements, p.parseName())
+			if !p.got(token.Comma) {
+				break
+			}
+		}
+	}
+	p.expect(token.Lbrace)
+	for p.tok.Type == token.Use {
+		enum.Traits = append(enum.Traits, p.parseTraitUseStmt())
+	}
+	enum.Members = p.parseMembers()
+	p.expect(token.Rbrace)
+	return enum
+}
+
+// Members = { ClassMember } .
+//
+// Blank lines between the members are kept as BlankLine.
+func (p *parser) parseMembers() []Member {
+	var members []Member
+	for {
+		for _, c := range p.commentStmts(len(members) == 0) {
+			members = append(members, c)
+		}
+		if !p.until(token.Rbrace) {
+			return members
+		}
+		if len(members) > 0 && p.blankLine() {
+			members = append(members, new(BlankLine))
+		}
+		start := p.startPos()
+		m := p.parseMember()
+		p.span(m, start)
+		members = append(members, m)
+	}
+}
+
+// ClassMember = [ PHPDoc ] [ Visibility ] { "static" | "readonly" }
+//
+//	( ConstDecl | [ Type ] VarDecl | FuncDecl | EnumCase ) .
+func (p *parser) parseMember() Member {
+	m := new(ClassMemberDecl)
+	m.Doc = p.parsePHPDoc()
+	p.leading(m)
+	m.Attrs = p.parseAttrs()
+	visPos := p.tok.Pos
+	m.Vis = p.parseVisibility()
+	var static, readonly bool
+	for {
+		if p.got(token.Static) {
+			static = true
+		} else if p.got(token.Readonly) {
+			readonly = true
+		} else {
+			p.checkReadonly()
+			break
+		}
+	}
+	switch p.tok.Type {
+	default:
+		pos := p.tok.Pos
+		typ := p.tryParseType()
+		if typ == nil {
+			p.errorf("unexpected %v, expecting %v, %v or %v", p.tok, token.Const, token.Var, token.Function)
+			return nil
+		}
+		p.requireVersion(pos, token.PHP74, "typed property")
+		v := p.parseVarDecl(nil, static)
+		v.Readonly = readonly
+		v.Type = typ
+		m.Decl = v
 	case token.Const:
-		if static {
-			p.errorf("unexpected %v in constant declaration", token.Static)
+		if static || readonly {
+			p.errorf("unexpected modifier in constant declaration")
+		}
+		if m.Vis != DefaultVis {
+			p.requireVersion(visPos, token.PHP71, "class constant visibility")
 		}
-		m.Decl = p.parseConstDecl(nil)
+		m.Decl = p.parseConstDecl(nil, true)
 	case token.Var:
-		m.Decl = p.parseVarDecl(nil, static)
+		v := p.parseVarDecl(nil, static)
+		v.Readonly = readonly
+		m.Decl = v
 	case token.Function:
+		if readonly {
+			p.errorf("unexpected %v in method declaration", token.Readonly)
+		}
 		m.Decl = p.parseFuncDecl(nil, static)
+	case token.Case:
+		if m.Vis != DefaultVis || static || readonly {
+			p.errorf("unexpected modifier in enum case declaration")
+		}
+		m.Decl = p.parseEnumCase()
 	}
 	return m
 }
 
-// Visibility = "public" | "protected" | "private" .
+// checkReadonly reports an error if the current token is the readonly
+// modifier scanned as an identifier. In such PHP versions, readonly
+// followed by a variable is a class name (i.e. a type).
+func (p *parser) checkReadonly() {
+	if !demoted(p.tok, token.Readonly) {
+		return
+	}
+	tok := p.tok
+	p.next()
+	typ := p.tok.Type
+	p.backup()
+	switch typ {
+	case token.Var, token.And, token.Ellipsis:
+	default:
+		p.requireKeyword(tok, token.Readonly)
+	}
+}
+
+// EnumCase = "case" Ident [ "=" Expr ] ";" .
+func (p *parser) parseEnumCase() *EnumCase {
+	c := new(EnumCase)
+	p.expect(token.Case)
+	c.Name = p.parseIdent()
+	if p.got(token.Assign) {
+		c.X = p.parseExpr()
+	}
+	p.expect(token.Semicolon)
+	c.Comment = p.parseOptComment()
+	return c
+}
+
+// Visibility = "public" | "protected" | "private" | "var" .
 func (p *parser) parseVisibility() Vis {
 	var v Vis
 	switch p.tok.Type {
 	default:
 		return DefaultVis
-	case token.Public:
+	case token.Public, token.VarKeyword:
+		// The legacy var is a synonym for public.
 		v = Public
 	case token.Protected:
 		v = Protected
@@ -464,20 +1202,31 @@ func phpDocErr(p token.Pos, d *phpdoc.SyntaxError) error {
 	return e
 }
 
-// BlockStmt = "{" { Stmt } "}" .
+// BlockStmt = "{" [ comment ] { Stmt } "}" .
 func (p *parser) parseBlockStmt() *BlockStmt {
 	block := new(BlockStmt)
+	p.leading(block)
 	p.expect(token.Lbrace)
+	block.Comment = p.parseEndComment()
 	for {
+		block.List = append(block.List, p.commentStmts(len(block.List) == 0)...)
 		if p.got(token.Rbrace) || p.err != nil {
+			p.trailing(block)
 			return block
 		}
-		block.List = append(block.List, p.parseStmt(nil))
+		if len(block.List) > 0 && p.blankLine() {
+			block.List = append(block.List, new(BlankLine))
+		}
+		start := p.startPos()
+		stmt := p.parseStmt(nil)
+		p.span(stmt, start)
+		block.List = append(block.List, stmt)
 	}
 }
 
-// Stmt = CommentStmt |
+// Stmt = InlineHTMLStmt |
 //
+//	EchoTagStmt |
 //	BlockStmt |
 //	IfStmt |
 //	SwitchStmt |
@@ -486,11 +1235,16 @@ func (p *parser) parseBlockStmt() *BlockStmt {
 //	UnknownStmt .
 func (p *parser) parseStmt(doc *phpdoc.Block) Stmt {
 	switch p.tok.Type {
-	case token.Comment:
+	case token.CloseTag, token.InlineHTML:
 		if doc != nil {
-			p.errorf("unexpected %v after %v", token.Lbrace, token.DocComment)
+			p.errorf("unexpected %v after %v", p.tok.Type, token.DocComment)
 		}
-		return &CommentStmt{Text: p.expect(token.Comment)}
+		return p.parseInlineHTMLStmt()
+	case token.EchoTag:
+		if doc != nil {
+			p.errorf("unexpected %v after %v", token.EchoTag, token.DocComment)
+		}
+		return p.parseEchoTagStmt()
 	case token.Lbrace:
 		if doc != nil {
 			p.errorf("unexpected %v after %v", token.Lbrace, token.DocComment)
@@ -521,45 +1275,189 @@ func (p *parser) parseStmt(doc *phpdoc.Block) Stmt {
 	}
 }
 
-// IfStmt = "if" "(" Expr ")" Stmt [ "else" Stmt ] .
+// InlineHTMLStmt = [ "?>" ] [ inlineHTML ] [ "<?php" ] .
+func (p *parser) parseInlineHTMLStmt() *InlineHTMLStmt {
+	stmt := new(InlineHTMLStmt)
+	if p.tok.Type == token.CloseTag {
+		p.next()
+	}
+	if p.tok.Type == token.InlineHTML {
+		stmt.Text = p.tok.Text
+		p.next()
+	}
+	if p.tok.Type == token.OpenTag {
+		p.openTag(&stmt.OneLinePHP)
+	}
+	return stmt
+}
+
+// EchoTagStmt = "<?=" Expr [ ";" ] [ "?>" [ "<?php" ] ] .
+func (p *parser) parseEchoTagStmt() *EchoTagStmt {
+	stmt := new(EchoTagStmt)
+	p.expect(token.EchoTag)
+	stmt.X = p.parseExpr()
+	p.got(token.Semicolon)
+	if p.tok.Type == token.EOF {
+		return stmt
+	}
+	p.expect(token.CloseTag)
+	if p.tok.Type == token.OpenTag {
+		p.openTag(&stmt.OneLinePHP)
+	}
+	return stmt
+}
+
+// openTag consumes an open tag. It sets *oneLine if the PHP code that
+// follows is closed by ?> on the same line.
+func (p *parser) openTag(oneLine *bool) {
+	p.segment, p.openLine = oneLine, p.tok.Pos.Line
+	p.next()
+}
+
+// IfStmt = "if" "(" Expr ")" ( Stmt [ "else" Stmt ] | AltIf ) .
 func (p *parser) parseIfStmt() Stmt {
 	i := new(IfStmt)
 	p.expect(token.If)
 	p.expect(token.Lparen)
 	i.Cond = p.parseExpr()
 	p.expect(token.Rparen)
+	if p.tok.Type == token.Colon {
+		p.parseAltIf(i)
+		return i
+	}
 	i.Body = p.parseStmt(nil)
-	if p.got(token.Else) {
+	if p.tok.Type == token.Else {
+		// Comments before else go with it.
+		lead := p.takeLeading()
+		p.next()
 		i.Else = p.parseStmt(nil)
+		p.addLeading(i.Else, lead)
 	}
 	return i
 }
 
-// IfStmt = "switch" "(" Expr ")" CaseBlockStmt .
+// AltIf = AltBody { "elseif" "(" Expr ")" AltBody }
+//
+//	[ "else" AltBody ] "endif" AltEnd .
+func (p *parser) parseAltIf(i *IfStmt) {
+	i.Alt = true
+	i.Body = p.parseAltBody(false, token.Else, token.Endif)
+	for cur := i; p.tok.Type == token.Else; {
+		// Comments before else go with it.
+		lead := p.takeLeading()
+		p.next()
+		if p.got(token.If) {
+			// The scanner splits elseif into else and if.
+			e := &IfStmt{Alt: true}
+			p.expect(token.Lparen)
+			e.Cond = p.parseExpr()
+			p.expect(token.Rparen)
+			e.Body = p.parseAltBody(false, token.Else, token.Endif)
+			cur.Else = e
+			p.addLeading(e, lead)
+			cur = e
+			continue
+		}
+		cur.Else = p.parseAltBody(false, token.Endif)
+		p.addLeading(cur.Else, lead)
+		break
+	}
+	p.expect(token.Endif)
+	p.parseAltEnd()
+	p.trailing(i)
+}
+
+// AltBody = ":" [ comment ] { Stmt } .
+//
+// The statements go up to one of the end keywords. If cases is set,
+// the body might contain case labels.
+func (p *parser) parseAltBody(cases bool, end ...token.Type) *BlockStmt {
+	block := new(BlockStmt)
+	p.expect(token.Colon)
+	block.Comment = p.parseEndComment()
+	for {
+		block.List = append(block.List, p.commentStmts(len(block.List) == 0)...)
+		if p.err != nil || p.tok.Type == token.EOF || isAny(p.tok.Type, end) {
+			return block
+		}
+		if len(block.List) > 0 && p.blankLine() {
+			block.List = append(block.List, new(BlankLine))
+		}
+		start := p.startPos()
+		var stmt Stmt
+		if cases {
+			if c := p.tryParseCaseClause(); c != nil {
+				stmt = c
+			}
+		}
+		if stmt == nil {
+			stmt = p.parseStmt(nil)
+		}
+		p.span(stmt, start)
+		block.List = append(block.List, stmt)
+	}
+}
+
+// AltEnd = ";" | /* before "?>" */ .
+func (p *parser) parseAltEnd() {
+	if p.tok.Type != token.CloseTag {
+		p.expect(token.Semicolon)
+	}
+}
+
+func isAny(typ token.Type, list []token.Type) bool {
+	for _, t := range list {
+		if typ == t {
+			return true
+		}
+	}
+	return false
+}
+
+// SwitchStmt = "switch" "(" Expr ")"
+//
+//	( CaseBlockStmt | AltCaseBody "endswitch" AltEnd ) .
 func (p *parser) parseSwitchStmt() Stmt {
 	s := new(SwitchStmt)
 	p.expect(token.Switch)
 	p.expect(token.Lparen)
 	s.Tag = p.parseExpr()
 	p.expect(token.Rparen)
+	if p.tok.Type == token.Colon {
+		s.Alt = true
+		s.Body = p.parseAltBody(true, token.Endswitch)
+		p.expect(token.Endswitch)
+		p.parseAltEnd()
+		p.trailing(s)
+		return s
+	}
 	s.Body = p.parseCaseBlockStmt()
 	return s
 }
 
-// CaseBlockStmt = "{" { CaseLabel | Stmt } "}" .
+// CaseBlockStmt = "{" [ comment ] { CaseLabel | Stmt } "}" .
 func (p *parser) parseCaseBlockStmt() *BlockStmt {
 	block := new(BlockStmt)
+	p.leading(block)
 	p.expect(token.Lbrace)
+	block.Comment = p.parseEndComment()
 	for {
+		block.List = append(block.List, p.commentStmts(len(block.List) == 0)...)
 		if p.got(token.Rbrace) || p.err != nil {
+			p.trailing(block)
 			return block
 		}
+		if len(block.List) > 0 && p.blankLine() {
+			block.List = append(block.List, new(BlankLine))
+		}
+		start := p.startPos()
 		var stmt Stmt
 		if c := p.tryParseCaseClause(); c != nil {
 			stmt = c
 		} else {
 			stmt = p.parseStmt(nil)
 		}
+		p.span(stmt, start)
 		block.List = append(block.List, stmt)
 	}
 }
@@ -576,7 +1474,9 @@ func (p *parser) tryParseCaseClause() *CaseLabel {
 	return c
 }
 
-// ForStmt = "for" "(" [ Expr ] ";" [ Expr ]  ";" [ Expr ]  ")" Stmt .
+// ForStmt = "for" "(" [ Expr ] ";" [ Expr ]  ";" [ Expr ]  ")"
+//
+//	( Stmt | AltBody "endfor" AltEnd ) .
 func (p *parser) parseForStmt() Stmt {
 	f := new(ForStmt)
 	p.expect(token.For)
@@ -593,27 +1493,70 @@ func (p *parser) parseForStmt() Stmt {
 		f.Post = p.parseExpr()
 		p.expect(token.Rparen)
 	}
+	if p.tok.Type == token.Colon {
+		f.Alt = true
+		f.Body = p.parseAltBody(false, token.Endfor)
+		p.expect(token.Endfor)
+		p.parseAltEnd()
+		p.trailing(f)
+		return f
+	}
 	f.Body = p.parseStmt(nil)
 	return f
 }
 
-// ForStmt = "try" BlockStmt { Catch } .
+// ForStmt = "try" BlockStmt { Catch } [ "finally" BlockStmt ] .
 func (p *parser) parseTryStmt() Stmt {
 	t := new(TryStmt)
 	p.expect(token.Try)
 	t.Body = p.parseBlockStmt()
-	for p.got(token.Catch) {
+	for p.tok.Type == token.Catch {
 		c := new(Catch)
+		p.leading(c)
+		p.next()
 		p.expect(token.Lparen)
 		c.Cond = p.parseExpr()
+		p.catchFeature(c.Cond)
 		p.expect(token.Rparen)
 		c.Body = p.parseBlockStmt()
 		t.Catches = append(t.Catches, c)
 	}
+	if p.tok.Type == token.Finally {
+		// Comments before finally go with it.
+		lead := p.takeLeading()
+		p.next()
+		t.Finally = p.parseBlockStmt()
+		p.addLeading(t.Finally, lead)
+	}
 	return t
 }
 
-// Type = [ "?" ] Name .
+// catchFeature records the syntax of the condition x of a catch
+// clause.
+func (p *parser) catchFeature(x Expr) {
+	u, ok := x.(*UnknownExpr)
+	if !ok || u == nil {
+		return
+	}
+	hasVar := false
+	for _, elem := range u.Elems {
+		switch tok, _ := elem.(token.Token); tok.Type {
+		case token.Or:
+			p.requireVersion(tok.Pos, token.PHP71, "multi-catch")
+		case token.Var:
+			hasVar = true
+		}
+	}
+	if !hasVar {
+		p.requireVersion(p.tok.Pos, token.PHP80, "catch without variable")
+	}
+}
+
+// Type     = [ "?" ] TypeName | TypeName { "|" TypeName } |
+//
+//	TypeName "&" TypeName { "&" TypeName } .
+//
+// TypeName = Name | "array" | "callable" | "static" .
 func (p *parser) parseType() *Type {
 	typ := p.tryParseType()
 	if typ == nil {
@@ -624,22 +1567,99 @@ func (p *parser) parseType() *Type {
 
 func (p *parser) tryParseType() *Type {
 	typ := new(Type)
-	switch p.tok.Type {
-	default:
-		return nil
-	case token.Qmark:
+	if p.tok.Type == token.Qmark {
+		p.requireVersion(p.tok.Pos, token.PHP71, "nullable type")
 		typ.Nullable = true
 		p.next()
-		fallthrough
-	case token.Ident, token.Backslash:
-		typ.Name = p.parseName()
+	}
+	pos := []token.Pos{p.tok.Pos}
+	typ.Name = p.tryParseTypeName()
+	if typ.Name == nil {
+		if typ.Nullable {
+			p.errorf("unexpected %v, expecting type", p.tok.Type)
+		}
+		return nil
+	}
+	for !typ.Nullable && p.tok.Type == token.Or {
+		p.requireVersion(p.tok.Pos, token.PHP80, "union type")
+		p.next()
+		pos = append(pos, p.tok.Pos)
+		n := p.tryParseTypeName()
+		if n == nil {
+			p.errorf("unexpected %v, expecting type", p.tok.Type)
+			return nil
+		}
+		typ.Union = append(typ.Union, n)
+	}
+	for !typ.Nullable && len(typ.Union) == 0 && p.tok.Type == token.And {
+		// By-reference params have types followed by "&" too.
+		and := p.tok
+		p.next()
+		next := p.tok.Type
+		p.backup()
+		if next == token.Var || next == token.Ellipsis || next == token.And {
+			break
+		}
+		p.requireVersion(and.Pos, token.PHP81, "intersection type")
+		p.next()
+		pos = append(pos, p.tok.Pos)
+		n := p.tryParseTypeName()
+		if n == nil {
+			p.errorf("unexpected %v, expecting type", p.tok.Type)
+			return nil
+		}
+		typ.Intersection = append(typ.Intersection, n)
+	}
+	for i, n := range append(append([]*Name{typ.Name}, typ.Union...), typ.Intersection...) {
+		if len(n.Parts) != 1 || n.Global {
+			continue
+		}
+		name := strings.ToLower(n.Parts[0])
+		if len(typ.Union) > 0 && (name == "null" || name == "false") {
+			// Allowed in union types as of PHP 8.0.
+			continue
+		}
+		if v, ok := typeVersions[name]; ok {
+			p.requireVersion(pos[i], v, n.Parts[0]+" type")
+		}
 	}
 	return typ
 }
 
+func (p *parser) tryParseTypeName() *Name {
+	switch p.tok.Type {
+	case token.Ident, token.Backslash:
+		return p.parseName()
+	case token.Static:
+		p.requireVersion(p.tok.Pos, token.PHP80, "static type")
+		fallthrough
+	case token.Array, token.Callable:
+		n := &Name{Parts: []string{p.tok.Text}}
+		p.leading(n)
+		p.next()
+		p.trailing(n)
+		return n
+	}
+	return nil
+}
+
+// typeVersions maps built-in types to the versions that introduced
+// them. In earlier versions, they are class names.
+var typeVersions = map[string]token.Version{
+	"void":     token.PHP71,
+	"iterable": token.PHP71,
+	"object":   token.PHP72,
+	"mixed":    token.PHP80,
+	"never":    token.PHP81,
+	"null":     token.PHP82,
+	"false":    token.PHP82,
+	"true":     token.PHP82,
+}
+
 // Name = [ "\\" ] ident { "\\" ident } .
 func (p *parser) parseName() *Name {
 	id := new(Name)
+	p.leading(id)
 	if p.got(token.Backslash) {
 		id.Global = true
 	}
@@ -649,56 +1669,159 @@ func (p *parser) parseName() *Name {
 			break
 		}
 	}
+	p.trailing(id)
+	return id
+}
+
+// Ident = ident | /* semi-reserved word */ .
+func (p *parser) parseIdent() string {
+	if !isIdent(p.tok) {
+		p.errorf("expecting %v, found %v", token.Ident, p.tok)
+		return ""
+	}
+	id := p.tok.Text
+	p.next()
 	return id
 }
 
-// UnknownStmt = Expr ( ";" [ comment ] | BlockStmt ) .
+// isIdent reports whether tok can be used as an identifier where PHP
+// allows semi-reserved words, i.e. in member names, class constants and
+// named arguments.
+func isIdent(tok token.Token) bool {
+	switch tok.Type {
+	case token.Ident,
+		token.MagicClass, token.MagicDir, token.MagicFile, token.MagicFunction,
+		token.MagicLine, token.MagicMethod, token.MagicNamespace, token.MagicTrait:
+		return true
+	case token.Land, token.Lor:
+		// The and and or keywords, not && and ||.
+		return isLetter(tok.Text[0])
+	}
+	return tok.Type.IsKeyword()
+}
+
+func isLetter(c byte) bool { return 'a' <= c|0x20 && c|0x20 <= 'z' }
+
+// UnknownStmt = Expr ( ";" [ comment ] | BlockStmt [ DoWhile ] | AltStmt | /* before "?>" */ ) .
+// DoWhile     = "while" Expr ( ";" [ comment ] | /* before "?>" */ ) .
+// AltStmt     = AltBody ( "endforeach" | "endwhile" | "enddeclare" )
+//
+//	( ";" [ comment ] | /* before "?>" */ ) .
+//
+// Only the statements that start with do have a DoWhile, and only
+// the ones that start with foreach, while, or declare have an AltStmt.
 func (p *parser) parseUnknownStmt(doc *phpdoc.Block) *UnknownStmt {
 	stmt := new(UnknownStmt)
 	stmt.Doc = doc
-	stmt.X = p.parseUnknownExpr()
+	stmt.X = p.parseUnknownExpr(false, false)
+	if x, ok := stmt.X.(*UnknownExpr); ok && x != nil && len(x.Elems) > 2 {
+		// The keyword enum is followed by a name.
+		tok, _ := x.Elems[0].(token.Token)
+		space, _ := x.Elems[1].(token.Token)
+		name, _ := x.Elems[2].(token.Token)
+		if demoted(tok, token.Enum) && space.Type == token.Whitespace && name.Type == token.Ident {
+			p.requireKeyword(tok, token.Enum)
+		}
+	}
 	switch p.tok.Type {
 	case token.Semicolon:
-		p.next0()
-		if ws := p.tok; ws.Type == token.Whitespace {
-			p.next()
-			if strings.ContainsRune(ws.Text, '\n') {
-				break
-			}
-		}
-		if p.tok.Type == token.Comment {
-			stmt.Comment = p.tok.Text
-			p.next()
-		}
+		p.next()
+		stmt.Comment = p.parseOptComment()
 	case token.Lbrace:
 		stmt.Body = p.parseBlockStmt()
+		if p.tok.Type != token.While || !isDo(stmt.X) {
+			break
+		}
+		// Comments before while go with it.
+		lead := p.takeLeading()
+		p.next()
+		stmt.While = p.parseExpr()
+		p.addLeading(stmt.While, lead)
+		if p.got(token.Semicolon) {
+			stmt.Comment = p.parseOptComment()
+		} else if p.tok.Type != token.CloseTag {
+			p.expect(token.Semicolon)
+		}
+	case token.Colon:
+		end := endKeyword(stmt.X)
+		if end == token.Illegal {
+			break
+		}
+		stmt.Alt = true
+		stmt.Body = p.parseAltBody(false, end)
+		p.expect(end)
+		if p.got(token.Semicolon) {
+			stmt.Comment = p.parseOptComment()
+		} else if p.tok.Type != token.CloseTag {
+			p.expect(token.Semicolon)
+		}
 	}
 	return stmt
 }
 
+// isDo reports whether x is the keyword do, i.e. whether it starts
+// a do-while statement.
+func isDo(x Expr) bool {
+	u, ok := x.(*UnknownExpr)
+	return ok && u != nil && len(u.Elems) > 0 && tokenType(u.Elems[0]) == token.Do
+}
+
+// endKeyword returns the keyword that ends the alternative syntax of
+// the control structure x starts (e.g. endforeach for foreach), or
+// token.Illegal if there's none.
+func endKeyword(x Expr) token.Type {
+	if u, ok := x.(*UnknownExpr); ok && len(u.Elems) > 0 {
+		if tok, ok := u.Elems[0].(token.Token); ok {
+			switch tok.Type {
+			case token.Foreach:
+				return token.Endforeach
+			case token.While:
+				return token.Endwhile
+			case token.Declare:
+				return token.Enddeclare
+			}
+		}
+	}
+	return token.Illegal
+}
+
 // Expr = UnknownExpr .
-func (p *parser) parseExpr() Expr { return p.parseUnknownExpr() }
+func (p *parser) parseExpr() Expr { return p.parseUnknownExpr(false, false) }
 
 // ConstExpr = BasicLit | ArrayLit .
 // ArrayLit  = "[" [ ConstExpr { "," ConstExpr } [ "," ] ] "]" .
 func (p *parser) parseConstExpr() Expr {
+	lead := p.takeLeading()
+	x := p.parseConstOperand()
+	if x != nil {
+		p.addLeading(x, lead)
+		p.trailing(x)
+	}
+	return x
+}
+
+func (p *parser) parseConstOperand() Expr {
 	if p.got(token.Lbrack) {
 		a := new(ArrayLit)
-		for !p.got(token.Rbrack) && !p.got(token.EOF) {
+		for p.until(token.Rbrack) {
 			a.Elems = append(a.Elems, p.parseConstExpr())
-			if p.got(token.Rbrack) {
+			if p.tok.Type == token.Rbrack {
 				break
 			}
 			p.expect(token.Comma)
 		}
+		if n := len(a.Elems); n > 0 {
+			p.closing(a.Elems[n-1])
+		}
+		p.expect(token.Rbrack)
 		return a
 	}
-	if p.tok.Type == token.Ident {
+	if p.tok.Type == token.Ident || p.tok.Type == token.Backslash {
 		// TODO: This needs some rethinking.
 		n := p.parseName()
 		if p.got(token.DoubleColon) {
 			x := &StaticSelectorExpr{X: n}
-			x.Sel = p.expect(token.Ident)
+			x.Sel = p.parseIdent()
 			return x
 		}
 		return n
@@ -724,32 +1847,132 @@ func (p *parser) parseFuncLit() *FuncLit {
 	return fn
 }
 
-// BasicLit = string | int | ident .
+// BasicLit = string | int | ident | magicConst .
 func (p *parser) parseBasicLit() Expr {
 	// TODO: This needs some more work.
 	switch p.tok.Type {
 	default:
 		p.errorf("unexpected %v, expecting lit", p.tok.Type)
 		return nil
-	case token.String, token.Int, token.Ident:
+	case token.String:
+		if isHeredoc(p.tok) {
+			return p.parseHeredocLit()
+		}
+		fallthrough
+	case token.Int, token.Ident,
+		token.MagicClass, token.MagicDir, token.MagicFile, token.MagicFunction,
+		token.MagicLine, token.MagicMethod, token.MagicNamespace, token.MagicTrait:
 		lit := &UnknownExpr{[]interface{}{p.tok}}
 		p.next()
 		return lit
 	}
 }
 
+// MatchExpr = "match" "(" Expr ")" "{" [ UnknownExpr ] "}" .
+func (p *parser) parseMatchExpr() *MatchExpr {
+	x := new(MatchExpr)
+	p.expect(token.Match)
+	p.expect(token.Lparen)
+	x.Cond = p.parseExpr()
+	p.expect(token.Rparen)
+	p.expect(token.Lbrace)
+	if p.tok.Type != token.Rbrace {
+		x.Arms = p.parseUnknownExpr(false, true)
+	}
+	p.expect(token.Rbrace)
+	return x
+}
+
+// HeredocLit = heredoc .
+func (p *parser) parseHeredocLit() *HeredocLit {
+	lit := new(HeredocLit)
+	text := p.tok.Text
+	p.next()
+
+	// The scanner has already checked the syntax.
+	i := strings.IndexByte(text, '\n')
+	label := strings.TrimSpace(text[len("<<<"):i])
+	lit.Nowdoc = strings.HasPrefix(label, "'")
+	lit.Label = strings.Trim(label, `'"`)
+
+	lines := strings.Split(text[i+1:], "\n")
+	closing := lines[len(lines)-1]
+	indent := len(closing) - len(lit.Label)
+	lit.Indented = indent > 0
+	for i, line := range lines[:len(lines)-1] {
+		var cr string
+		if strings.HasSuffix(line, "\r") {
+			line = line[:len(line)-1]
+			// The last line break isn't a part of the literal.
+			if i < len(lines)-2 {
+				cr = "\r"
+			}
+		}
+		if len(line) < indent {
+			// Blank lines might be indented less.
+			line = ""
+		} else {
+			line = line[indent:]
+		}
+		lit.Lines = append(lit.Lines, line+cr)
+	}
+	return lit
+}
+
+func isHeredoc(tok token.Token) bool {
+	return tok.Type == token.String && strings.HasPrefix(tok.Text, "<<<")
+}
+
 // UnknownExpr =  ExprElem { ExprElem } .
-// ExprElem    =  /* any token */ | "{" Expr "}" | FuncLit .
-func (p *parser) parseUnknownExpr() *UnknownExpr {
+// ExprElem    =  /* any token */ | "{" Expr "}" | "(" Args ")" |
+//
+//	FuncLit | HeredocLit .
+//
+// Args        =  [ Ident ":" ] UnknownExpr { "," [ Ident ":" ] UnknownExpr } .
+//
+// If args is set, the expression might contain named arguments. The
+// whitespace between the elements is kept. If space is set, so is the
+// whitespace before the expression.
+func (p *parser) parseUnknownExpr(args, space bool) *UnknownExpr {
 	var allowedColons int
+	argStart := args
 	x := new(UnknownExpr)
 	for {
+		if p.appendComments(x, space) {
+			space = true
+		}
+		if space && p.space.Text != "" {
+			x.Elems = append(x.Elems, p.space)
+		}
+		space = true
+		if argStart && isIdent(p.tok) {
+			// Named arguments may be semi-reserved words.
+			label := p.tok
+			p.next()
+			if p.tok.Type == token.Colon {
+				p.requireVersion(label.Pos, token.PHP80, "named argument")
+				x.Elems = append(x.Elems, label, p.tok)
+				p.next()
+				argStart = false
+				continue
+			}
+			p.backup()
+		}
+		argStart = false
+		p.exprFeature(x.Elems, args)
+
 		switch p.tok.Type {
 		// TODO: EOF or ?>
 		case token.EOF:
+			if p.exprEOF && len(x.Elems) > 0 {
+				if tok, ok := x.Elems[len(x.Elems)-1].(token.Token); ok && tok.Type == token.Whitespace {
+					x.Elems = x.Elems[:len(x.Elems)-1]
+				}
+				return x
+			}
 			p.errorf("unexpected %v, expecting %v, %v, %v or %v", p.tok, token.Semicolon, token.Lbrace, token.Rbrace, token.Rparen)
 			return nil
-		case token.Semicolon, token.Lbrace, token.Rbrace, token.Rparen:
+		case token.Semicolon, token.Lbrace, token.Rbrace, token.Rparen, token.CloseTag:
 			if len(x.Elems) == 0 {
 				p.errorf("unexpected empty expression")
 			}
@@ -759,59 +1982,290 @@ func (p *parser) parseUnknownExpr() *UnknownExpr {
 		case token.Qmark:
 			allowedColons++
 			x.Elems = append(x.Elems, p.tok)
-			p.next0()
+			p.next()
 		case token.Colon:
 			if allowedColons == 0 {
+				if len(x.Elems) == 0 {
+					p.errorf("unexpected %v", p.tok)
+				}
 				return x
 			}
 			allowedColons--
 			x.Elems = append(x.Elems, p.tok)
-			p.next0()
+			p.next()
 
-		case token.Arrow:
+		case token.Comma:
+			x.Elems = append(x.Elems, p.tok)
+			p.next()
+			argStart = args
+		case token.Arrow, token.QmarkArrow:
 			x.Elems = append(x.Elems, p.tok)
 			p.next()
 			tok := p.tok
 			// Take any token that comes. Apparently you can
 			// call a method that has a keyword as a name (e.g.
 			// (expr)->class(args)).
+			p.appendSelComments(x)
 			x.Elems = append(x.Elems, p.tok)
-			p.next0()
+			p.next()
 			if tok.Type == token.Lbrace {
-				p.consume(token.Whitespace)
 				x.Elems = append(x.Elems, p.parseExpr(), p.expect(token.Rbrace))
+				space = false
 			}
 		case token.DoubleColon:
 			// The next token might be "class", so we want
 			// to consume 2 tokens (ignoring whitespace).
 			x.Elems = append(x.Elems, p.tok)
 			p.next()
+			p.appendSelComments(x)
 			x.Elems = append(x.Elems, p.tok)
-			p.next0()
+			p.next()
 		case token.Lparen:
-			x.Elems = append(x.Elems, p.tok)
-			p.next0()
-			if p.tok.Type == token.Rparen {
-				// TODO: Remove special case for empty ()
-				x.Elems = append(x.Elems, p.tok)
-				p.next0()
+			fn := callee(x.Elems)
+			if !p.parseParens(x) {
+				return nil
+			}
+			p.argsFeature(x.Elems)
+			if fn < 0 {
 				continue
 			}
-			x.Elems = append(x.Elems, p.parseExpr())
-			if p.tok.Type != token.Rparen {
-				// Avoid using p.expect so we don't eat a whitespace token.
-				p.errorf("unexpected %v, expecting %v", p.tok, token.Rparen)
-				return nil
+			// Keywords of later versions are identifiers.
+			if name := x.Elems[fn].(token.Token); demoted(name, token.Fn) && p.tok.Type == token.DoubleArrow {
+				p.requireKeyword(name, token.Fn)
+			} else if demoted(name, token.Match) && p.tok.Type == token.Lbrace {
+				p.requireKeyword(name, token.Match)
 			}
-			x.Elems = append(x.Elems, p.tok.Text)
-			p.next0()
+		case token.AttrStart:
+			// Attributes of closures and anonymous classes.
+			x.Elems = append(x.Elems, p.parseAttrGroup())
 		case token.Class:
 			x.Elems = append(x.Elems, p.parseAnonymClassDecl())
+			space = false
+		case token.Match:
+			x.Elems = append(x.Elems, p.parseMatchExpr())
 		case token.Function:
 			x.Elems = append(x.Elems, p.parseFuncLit())
+			space = false
+		case token.String:
+			if isHeredoc(p.tok) {
+				x.Elems = append(x.Elems, p.parseHeredocLit())
+				continue
+			}
+			x.Elems = append(x.Elems, p.tok)
+			p.next()
 		default:
 			x.Elems = append(x.Elems, p.tok)
-			p.next0()
+			p.next()
+		}
+	}
+}
+
+// exprFeature records the syntax the current token starts in an
+// expression, which continues the elements elems. If args is set,
+// the expression is an argument.
+func (p *parser) exprFeature(elems []interface{}, args bool) {
+	pos := p.tok.Pos
+	switch p.tok.Type {
+	case token.Throw:
+		// Throw statements start expressions.
+		if args || prevSignificant(elems, len(elems)) >= 0 {
+			p.requireVersion(pos, token.PHP80, "throw expression")
+		}
+	case token.Ellipsis:
+		// Calls have unpacked arguments since PHP 5.6.
+		if i := openBracket(elems); i >= 0 && tokenType(elems[i]) == token.Lbrack && !isIndex(elems, i) {
+			p.requireVersion(pos, token.PHP74, "array unpacking")
+		}
+	case token.Assign:
+		i := prevSignificant(elems, len(elems))
+		if i < 0 || tokenType(elems[i]) != token.Rbrack {
+			break
+		}
+		if i = openBracket(elems[:i]); i >= 0 && !isIndex(elems, i) {
+			p.requireVersion(elems[i].(token.Token).Pos, token.PHP71, "short list syntax")
+		}
+	case token.Lbrack:
+		// E.g. foreach ($a as [$x, $y]).
+		if i := prevSignificant(elems, len(elems)); i >= 0 && tokenType(elems[i]) == token.As {
+			p.requireVersion(pos, token.PHP71, "short list syntax")
+		}
+	case token.Arrow, token.QmarkArrow, token.DoubleColon:
+		if isNew(elems) {
+			p.requireVersion(pos, token.PHP84, "new without parentheses")
+		}
+	}
+}
+
+// argsFeature records the syntax of the arguments that elems end with.
+func (p *parser) argsFeature(elems []interface{}) {
+	n := len(elems)
+	args, ok := elems[n-2].(*UnknownExpr)
+	if !ok {
+		// Empty arguments.
+		return
+	}
+	i := prevSignificant(args.Elems, len(args.Elems))
+	if i < 0 {
+		return
+	}
+	tok, _ := args.Elems[i].(token.Token)
+	switch {
+	case tok.Type == token.Ellipsis && prevSignificant(args.Elems, i) < 0:
+		p.requireVersion(tok.Pos, token.PHP81, "first-class callable syntax")
+	case tok.Type == token.Comma:
+		switch tokenType(prevElem(elems, n-3)) {
+		case token.Array, token.List:
+			// Trailing commas have always been allowed there.
+		case token.Fn:
+			p.requireVersion(tok.Pos, token.PHP80, "trailing comma in parameter list")
+		default:
+			p.requireVersion(tok.Pos, token.PHP73, "trailing comma in argument list")
+		}
+	}
+}
+
+// isNew reports whether elems end with the creation of an object that
+// isn't enclosed in parentheses (e.g. new A()).
+func isNew(elems []interface{}) bool {
+	i := prevSignificant(elems, len(elems))
+	if i < 0 {
+		return false
+	}
+	if _, ok := elems[i].(*ClassDecl); !ok {
+		switch elems[i].(type) {
+		case string:
+			i -= 2 // skip the args
+		case token.Token:
+			if tokenType(elems[i]) != token.Rparen {
+				return false
+			}
+			i--
+		default:
+			return false
+		}
+		if tokenType(elems[i]) != token.Lparen {
+			return false
+		}
+		i = prevSignificant(elems, i)
+		if i >= 0 && tokenType(elems[i]) == token.Var {
+			i = prevSignificant(elems, i)
+		} else {
+			for i >= 0 && isNamePart(tokenType(elems[i])) {
+				i = prevSignificant(elems, i)
+			}
+		}
+	} else {
+		i = prevSignificant(elems, i)
+	}
+	return i >= 0 && tokenType(elems[i]) == token.New
+}
+
+func isNamePart(typ token.Type) bool {
+	return typ == token.Ident || typ == token.Backslash || typ == token.Static
+}
+
+// openBracket returns the index of the innermost bracket elems leave
+// open, or -1.
+func openBracket(elems []interface{}) int {
+	depth := 0
+	for i := len(elems) - 1; i >= 0; i-- {
+		if depth += nesting(elems[i]); depth > 0 {
+			return i
 		}
 	}
+	return -1
+}
+
+// parseParens parses "(" Args ")" and appends it to x. The closing
+// parenthesis is appended as a string, unless the args are empty.
+// It reports whether the args were closed.
+func (p *parser) parseParens(x *UnknownExpr) bool {
+	x.Elems = append(x.Elems, p.tok)
+	p.next()
+	if p.tok.Type == token.Rparen && len(p.pending) == 0 {
+		// TODO: Remove special case for empty ()
+		x.Elems = append(x.Elems, p.tok)
+		p.next()
+		return true
+	}
+	x.Elems = append(x.Elems, p.parseUnknownExpr(true, true))
+	if p.tok.Type != token.Rparen {
+		p.errorf("unexpected %v, expecting %v", p.tok, token.Rparen)
+		return false
+	}
+	x.Elems = append(x.Elems, p.tok.Text)
+	p.next()
+	return true
+}
+
+// callee returns the index of the identifier elems end with if it
+// might be the name of a called function (i.e. it isn't the name of
+// a member or a part of a qualified name), or -1.
+func callee(elems []interface{}) int {
+	i := prevToken(elems, len(elems))
+	if i < 0 || elems[i].(token.Token).Type != token.Ident {
+		return -1
+	}
+	if j := prevToken(elems, i); j >= 0 {
+		switch elems[j].(token.Token).Type {
+		case token.Arrow, token.QmarkArrow, token.DoubleColon,
+			token.Backslash, token.Function, token.New:
+			return -1
+		}
+	}
+	return i
+}
+
+// prevToken returns the index of the last token before elems[i] that
+// is neither whitespace nor a comment, or -1 if the element there
+// isn't a token.
+func prevToken(elems []interface{}, i int) int {
+	for i--; i >= 0; i-- {
+		tok, ok := elems[i].(token.Token)
+		if !ok {
+			return -1
+		}
+		switch tok.Type {
+		case token.Whitespace, token.Comment, token.DocComment:
+			continue
+		}
+		return i
+	}
+	return -1
+}
+
+// prevSignificant returns the index of the last element before
+// elems[i] that is neither whitespace nor a comment, or -1.
+func prevSignificant(elems []interface{}, i int) int {
+	for i--; i >= 0; i-- {
+		switch tokenType(elems[i]) {
+		case token.Whitespace, token.Comment, token.DocComment:
+			continue
+		}
+		return i
+	}
+	return -1
+}
+
+// appendComments appends the pending comments to x. The whitespace
+// before the first one is kept only if space is set. It reports
+// whether there were any.
+func (p *parser) appendComments(x *UnknownExpr, space bool) bool {
+	list := p.takeComments(0, len(p.pending))
+	for _, c := range list {
+		if space && c.space.Text != "" {
+			x.Elems = append(x.Elems, c.space)
+		}
+		x.Elems = append(x.Elems, c.tok)
+		space = true
+	}
+	return len(list) > 0
+}
+
+// appendSelComments appends the comments between an arrow (or ::) and
+// the selector that follows to x.
+func (p *parser) appendSelComments(x *UnknownExpr) {
+	if p.appendComments(x, true) && p.space.Text != "" {
+		x.Elems = append(x.Elems, p.space)
+	}
 }
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"mibk.dev/php/ast"
+	"mibk.dev/php/token"
 )
 
 func TestSyntaxErrors(t *testing.T) {
@@ -22,9 +23,21 @@ func TestSyntaxErrors(t *testing.T) {
 		"<?php '",
 		`syntax:1:8: string not terminated`,
 	}, {
-		"wrong open tag",
-		`   <?php `,
-		`syntax:1:1: expecting <?php, found InlineHTML("   ")`,
+		"empty echo tag",
+		`<p><?= ?>`,
+		`syntax:1:8: unexpected empty expression`,
+	}, {
+		"enum case with modifier",
+		"<?php enum A { public case X; }",
+		`syntax:1:23: unexpected modifier in enum case declaration`,
+	}, {
+		"stray colon",
+		"<?php : ;",
+		`syntax:1:7: unexpected :`,
+	}, {
+		"halt compiler with args",
+		"<?php __halt_compiler(1);",
+		`syntax:1:23: unexpected Int("1"), expecting )`,
 	}, {
 		"invalid PHPDoc",
 		"<?php\n   /** @var */",
@@ -49,6 +62,10 @@ func TestSyntaxErrors(t *testing.T) {
 		"missing if cond",
 		`<?php if () echo;`,
 		`syntax:1:11: unexpected empty expression`,
+	}, {
+		"heredoc body indentation",
+		"<?php $x = <<<A\n  a\n b\n  A;",
+		`syntax:3:1: invalid body indentation level (expecting an indentation level of at least 2)`,
 	}}
 
 	for _, tt := range tests {
@@ -68,3 +85,175 @@ func TestSyntaxErrors(t *testing.T) {
 		}
 	}
 }
+
+func TestVersionErrors(t *testing.T) {
+	tests := []struct {
+		version token.Version
+		input   string
+		wantErr string
+	}{
+		{token.PHP70, "<?php function f(?int $x) {}", "syntax:1:18: nullable type requires PHP 7.1"},
+		{token.PHP70, "<?php function f(): Void {}", "syntax:1:21: Void type requires PHP 7.1"},
+		{token.PHP70, "<?php function f(): \\void {}", "<nil>"},
+		{token.PHP74, "<?php function f(mixed $x) {}", "syntax:1:18: mixed type requires PHP 8.0"},
+		{token.PHP70, "<?php class A { private const X = 1; }", "syntax:1:17: class constant visibility requires PHP 7.1"},
+		{token.PHP74, "<?php $a?->b;", "syntax:1:9: nullsafe operator requires PHP 8.0"},
+		{token.PHP74, "<?php class Match {}", "<nil>"},
+		{token.Latest, "<?php class Match {}", `syntax:1:13: expecting Ident, found match`},
+		{token.PHP73, "<?php $f = fn($x) => $x;", "syntax:1:12: arrow function requires PHP 7.4"},
+		{token.PHP73, "<?php $f = FN() => 1;", "syntax:1:12: arrow function requires PHP 7.4"},
+		{token.PHP73, "<?php $f = fn($x); $a->fn($x) => 1;", "<nil>"},
+		{token.PHP74, "<?php $y = match($a) { 1 => 2 };", "syntax:1:12: match expression requires PHP 8.0"},
+		{token.PHP74, "<?php $y = match($a); A::match($a);", "<nil>"},
+		{token.PHP80, "<?php enum E { case A; }", "syntax:1:7: enumeration requires PHP 8.1"},
+		{token.PHP80, "<?php enum E: string { case A = 'a'; }", "syntax:1:7: enumeration requires PHP 8.1"},
+		{token.PHP80, "<?php enum($x);", "<nil>"},
+		{token.PHP80, "<?php class A { public readonly int $x; }", "syntax:1:24: readonly property requires PHP 8.1"},
+		{token.PHP80, "<?php class A { readonly public int $x; }", "syntax:1:17: readonly property requires PHP 8.1"},
+		{token.PHP80, "<?php class A { function __construct(private readonly int $x) {} }", "syntax:1:46: readonly property requires PHP 8.1"},
+		{token.PHP80, "<?php class A { public readonly $x; }", "<nil>"},
+		{token.PHP74, "<?php #[A] function f() {}", "<nil>"},
+		{token.PHP80, "<?php #[A(1)]\n#[B] function f(#[C] $x) {}", "<nil>"},
+		{token.PHP80, "<?php #[A] $x = 1;", `syntax:1:12: unexpected Var("$x") after attribute`},
+		{token.PHP80, "<?php function f(A&B $x) {}", "syntax:1:19: intersection type requires PHP 8.1"},
+		{token.PHP80, "<?php function f(A &$x, B &...$y) {}", "<nil>"},
+		{token.PHP81, "<?php readonly class A {}", "syntax:1:7: readonly class requires PHP 8.2"},
+		{token.PHP82, "<?php class A { const int X = 1; }", "syntax:1:23: typed class constant requires PHP 8.3"},
+		{token.PHP82, "<?php class A { const X = 1; }", "<nil>"},
+	}
+
+	for _, tt := range tests {
+		_, err := ast.Parse(strings.NewReader(tt.input), token.WithVersion(tt.version))
+		errStr := "<nil>"
+		if err != nil {
+			if se, ok := err.(*ast.SyntaxError); ok {
+				err = fmt.Errorf("syntax:%d:%d: %v", se.Line, se.Column, se.Err)
+			}
+			errStr = err.Error()
+		}
+		if errStr != tt.wantErr {
+			t.Errorf("%s (PHP %v):\n got %s\nwant %s", tt.input, tt.version, errStr, tt.wantErr)
+		}
+	}
+}
+
+func TestCommentMap(t *testing.T) {
+	const input = `<?php
+function f(/* a */ $a, // first
+	$b) {}
+try {} /* t */ catch (E $e) {}`
+	file, err := ast.Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := file.Stmts[0].(*ast.FuncDecl)
+	try := file.Stmts[1].(*ast.TryStmt)
+	tests := []struct {
+		node     interface{}
+		leading  string
+		trailing string
+	}{
+		{fn.Params[0], "/* a */", "// first"},
+		{fn.Params[1], "", ""},
+		{try.Body, "", "/* t */"},
+	}
+	for i, tt := range tests {
+		var leading, trailing string
+		if c := file.Comments[tt.node]; c != nil {
+			for _, g := range c.Leading {
+				for _, c := range g.List {
+					leading += c.Text
+				}
+			}
+			if c.Trailing != nil {
+				for _, c := range c.Trailing.List {
+					trailing += c.Text
+				}
+			}
+		}
+		if leading != tt.leading || trailing != tt.trailing {
+			t.Errorf("%d: got %q, %q; want %q, %q", i, leading, trailing, tt.leading, tt.trailing)
+		}
+	}
+}
+
+func TestParseSnippets(t *testing.T) {
+	tests := []struct {
+		name  string
+		parse func(src string) (interface{}, error)
+		input string
+		want  string
+	}{
+		{"expr", parseExpr, `$a->b(1, [2])`, `$a->b(1, [2])`},
+		{"stmts", parseStmts, "$x = 1;\n\nif ($x) {\n\tfoo();\n}", "<?php\n\n$x = 1;\n\nif ($x) {\n\tfoo();\n}"},
+		{"func decl", parseStmts, "function f() {}", "<?php\n\nfunction f()\n{\n}\n"},
+		{"member", parseMember, "public static function f(int $x): void {}", "public static function f(int $x): void\n{\n}\n"},
+		{"trait use", parseMember, "use A, B { A::f insteadof B; }", "use A, B {\n\tA::f insteadof B;\n}\n"},
+		{"type", parseType, `?Foo\Bar`, `?Foo\Bar`},
+		{"union type", parseType, `int|string`, `int|string`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := tt.parse(tt.input)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			var got strings.Builder
+			if err := ast.Fprint(&got, node); err != nil {
+				t.Fatalf("printing: %v", err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("got %q, want %q", got.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSnippetErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		parse   func(src string) (interface{}, error)
+		input   string
+		wantErr string
+	}{
+		{"expr with semicolon", parseExpr, `$a;`, `syntax:1:3: unexpected ;, expecting EOF`},
+		{"empty expr", parseExpr, "", `syntax:1:1: missing expression`},
+		{"only comment", parseExpr, "// c\n", `syntax:2:1: missing expression`},
+		{"unterminated stmt", parseStmts, `echo 1`, `syntax:1:7: unexpected EOF, expecting ;, {, } or )`},
+		{"unbalanced expr", parseExpr, `foo(1`, `syntax:1:6: unexpected EOF, expecting )`},
+		{"two members", parseMember, "const A = 1;\nconst B = 2;", `syntax:2:1: unexpected const, expecting EOF`},
+		{"not a type", parseType, `$x`, `syntax:1:1: unexpected Var, expecting type`},
+	}
+	for _, tt := range tests {
+		_, err := tt.parse(tt.input)
+		errStr := "<nil>"
+		if err != nil {
+			if se, ok := err.(*ast.SyntaxError); ok {
+				err = fmt.Errorf("syntax:%d:%d: %v", se.Line, se.Column, se.Err)
+			}
+			errStr = err.Error()
+		}
+		if errStr != tt.wantErr {
+			t.Errorf("%s:\n got %s\nwant %s", tt.name, errStr, tt.wantErr)
+		}
+	}
+
+	// Not a nil *UnknownExpr.
+	if x, _ := ast.ParseExpr(""); x != nil {
+		t.Errorf("got %#v for an empty expression, want nil", x)
+	}
+}
+
+func parseExpr(src string) (interface{}, error) { return ast.ParseExpr(src) }
+
+func parseStmts(src string) (interface{}, error) {
+	list, err := ast.ParseStmts(src)
+	return &ast.File{Stmts: list}, err
+}
+
+func parseMember(src string) (interface{}, error) {
+	m, err := ast.ParseMember(src)
+	return []ast.Member{m}, err
+}
+
+func parseType(src string) (interface{}, error) { return ast.ParseType(src) }
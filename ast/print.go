@@ -2,126 +2,305 @@ package ast
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"strings"
 	"text/tabwriter"
+	"unicode/utf8"
 
 	"mibk.dev/php/token"
 	"mibk.dev/phpdoc"
 )
 
-// Fprint "pretty-prints" an AST node to w.
+// Fprint "pretty-prints" node to w in the Mibk style.
 func Fprint(w io.Writer, node interface{}) error {
-	w = &trimmer{output: w}
-	tw := tabwriter.NewWriter(w, 0, 8, 1, '\t', tabwriter.StripEscape)
+	c := Mibk
+	return c.Fprint(w, node)
+}
+
+// Fprint "pretty-prints" node to w. All the lines end with the same
+// line ending, except for the ones in literals and inline HTML, which
+// are copied from the source. Declarations are printed with their doc
+// comments.
+func (c *Config) Fprint(w io.Writer, node interface{}) error {
+	f, _ := node.(*File)
+	return c.fprint(w, f, func(p *printer) {
+		if d, ok := node.(Decl); ok {
+			p.print(d.doc())
+		}
+		p.print(node)
+	})
+}
+
+// fprint sets up a printer for the nodes of f (which might be nil),
+// prints them using print and writes the output to w.
+func (c *Config) fprint(w io.Writer, f *File, print func(p *printer)) error {
+	nl := aNewline
+	switch c.LineEnding {
+	case AutoLineEnding:
+		if f != nil && f.CRLF {
+			nl = aCRLF
+		}
+	case CRLF:
+		nl = aCRLF
+	}
+	padchar, flags := byte('\t'), uint(0)
+	if c.Align {
+		// Pad the cells with spaces, but keep the indentation.
+		padchar, flags = ' ', tabwriter.TabIndent|tabwriter.DiscardEmptyColumns
+	}
+	var output io.Writer = &trimmer{output: w, newline: nl}
+	var aligner *commentAligner
+	if c.Align {
+		aligner = &commentAligner{Config: c, output: output}
+		output = aligner
+	}
+	tw := tabwriter.NewWriter(output, 0, 8, 1, padchar, flags)
 	buf := bufio.NewWriter(tw)
-	p := &printer{buf: buf}
-	p.print(node)
+	p := &printer{Config: *c, buf: buf}
+	if f != nil {
+		p.comments = copyComments(f.Comments)
+	}
+	print(p)
 	if p.err != nil {
 		return p.err
 	}
 	if err := p.buf.Flush(); err != nil {
 		return err
 	}
-	return tw.Flush()
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if aligner != nil {
+		if err := aligner.endLine(); err != nil {
+			return err
+		}
+		if err := aligner.flush(); err != nil {
+			return err
+		}
+	}
+	// The data after __halt_compiler(); might be binary, so it
+	// bypasses the tabwriter and the trimmer.
+	_, err := io.WriteString(w, p.data)
+	return err
 }
 
 type indentation int
 
 type printer struct {
+	Config
 	buf *bufio.Writer
 	err error // sticky
 
+	col     int  // current column (0-based)
+	nl      int  // number of newlines the output ends with
+	measure bool // only measure the current line (see fits)
+
 	indent indentation
+	html   bool   // outside of PHP tags
+	closed bool   // a ?> has been printed
+	data   string // after __halt_compiler();
+
+	// If oneLine is set, the PHP code up to the next ?> is printed
+	// on one line: line breaks and indentation become a single space,
+	// which is pending until some other text follows. The next PHP
+	// code is printed on one line if nextOneLine is set.
+	oneLine, pendingSpace bool
+	nextOneLine           bool
+
+	// The comments of the nodes yet to be printed; see
+	// nodeComments. A line comment must be followed by a newline.
+	comments    CommentMap
+	lineComment bool
+
+	cells     bool // the current line is aligned with its neighbors (see Config.Align)
+	constExpr bool // names are constants (see constText)
 }
 
+// A resultType prints the return type of a function, if any.
+type resultType struct{ *Type }
+
 type whitespace byte
 
 const (
-	nextcol whitespace = '\v'
-	tabesc  whitespace = tabwriter.Escape
-	newline whitespace = '\n'
+	nextcol  whitespace = '\v'
+	tabesc   whitespace = tabwriter.Escape
+	newline  whitespace = '\n'
+	formfeed whitespace = '\f' // a newline that ends aligned sections
 )
 
+// escape is tabesc as a string.
+const escape = "\xff"
+
 func (p *printer) print(args ...interface{}) {
 	for _, arg := range args {
 		if p.err != nil {
 			return
 		}
+		if c := p.nodeComments(arg); c != nil {
+			_, decl := arg.(Decl)
+			switch arg.(type) {
+			case *UseStmt, *Pragma:
+				decl = true
+			}
+			// Declarations that start a line stay at the start.
+			p.leadingComments(c.Leading, decl && p.col == p.width(p.indentation(p.indent)))
+			p.print(arg)
+			p.trailingComments(c.Trailing)
+			continue
+		}
 
 		switch arg := arg.(type) {
 		case *File:
-			p.print(token.OpenTag, newline)
+			if arg.BOM {
+				p.print("\uFEFF")
+			}
+			if len(arg.Pragmas) == 0 && arg.Namespace == nil && len(arg.UseStmts) == 0 &&
+				len(arg.Stmts) > 0 && isHTML(arg.Stmts[0]) {
+				// Templates might start with HTML.
+				p.html = true
+			} else {
+				p.oneLine = arg.OneLinePHP
+				p.print(token.OpenTag, newline)
+			}
 			if len(arg.Pragmas) > 0 {
 				p.print(newline)
 			}
 			for _, d := range arg.Pragmas {
-				p.print(d)
+				p.print(d, newline)
 			}
-			if ns := arg.Namespace; ns != nil {
+			if arg.Namespace != nil {
+				p.print(newline)
+				c := p.nodeComments(arg.Namespace)
+				if c != nil {
+					p.leadingComments(c.Leading, true)
+				}
+				ns := *arg.Namespace
 				ns.Global = false // namespaces are global implicitly
-				p.print(newline, token.Namespace, ' ', ns, token.Semicolon, newline)
+				p.print(token.Namespace, ' ', &ns, token.Semicolon)
+				if c != nil {
+					p.trailingComments(c.Trailing)
+				}
+				p.print(newline)
 			}
 			if len(arg.UseStmts) > 0 {
 				p.print(newline)
 				for _, stmt := range arg.UseStmts {
+					p.cells = p.Align
 					p.print(stmt, newline)
+					p.cells = false
 				}
 			}
-			for _, stmt := range arg.Stmts {
-				p.print(newline)
-				if decl, ok := stmt.(Decl); ok {
-					p.print(decl.doc())
+			kinds := p.lineKinds(arg.Stmts, 0)
+			for i, stmt := range arg.Stmts {
+				if _, ok := stmt.(*BlankLine); ok {
+					// Declarations are already followed
+					// by a blank line.
+					if !p.html && p.nl == 0 {
+						p.print(newline)
+					}
+					continue
 				}
-				p.print(p.indent, stmt)
+				p.openTag(stmt)
+				if !p.html {
+					if i > 0 {
+						p.print(lineBreak(kinds[i-1], kinds[i]))
+					} else {
+						p.print(newline)
+					}
+					if decl, ok := stmt.(Decl); ok {
+						p.print(decl.doc())
+					}
+					p.print(p.indent)
+				}
+				p.cells = kinds[i] != plainLine
+				p.print(stmt)
+				p.cells = false
 				if _, ok := stmt.(*ClassDecl); ok {
-					// TODO: Come up with better heuristics.
+					// Like the other declarations, end
+					// classes with a blank line.
 					p.print(newline)
 				}
 			}
 		case *Pragma:
 			p.print(token.Declare, token.Lparen)
 			p.print(arg.Name, token.Assign, arg.Value)
-			p.print(token.Rparen, token.Semicolon, newline)
+			p.print(token.Rparen, token.Semicolon)
 		case *UseStmt:
 			name := arg.Name
-			name.Global = false // use statements are global implicitly
+			if name.Global && p.indent == 0 {
+				// Imports are global implicitly (unlike the
+				// traits used in classes, which are indented).
+				name = &Name{Parts: name.Parts}
+			}
 			p.print(token.Use, ' ', name)
+			for _, n := range arg.Others {
+				p.print(token.Comma, ' ', n)
+			}
 			if arg.Alias != "" {
 				p.print(' ', token.As, ' ', arg.Alias)
 			}
-			p.print(token.Semicolon)
+			if arg.Adaptations != nil {
+				p.body(SameLine, arg.Adaptations)
+			} else {
+				p.print(token.Semicolon)
+			}
 		case *ConstDecl:
-			p.print(token.Const, ' ', arg.Name, ' ', token.Assign, ' ')
+			sep := p.commentSep()
+			p.print(token.Const, ' ')
+			if arg.Type != nil {
+				p.print(arg.Type, ' ')
+			}
+			p.print(arg.Name, ' ', token.Assign, ' ')
 			p.print(arg.X, token.Semicolon)
 			if arg.Comment != "" {
-				p.print(' ', arg.Comment)
+				p.print(sep)
+				p.comment(arg.Comment)
 			}
 			p.print(newline)
 		case *VarDecl:
+			sep := p.commentSep()
 			if arg.Static {
 				p.print(token.Static, ' ')
 			}
+			if arg.Readonly {
+				p.print(token.Readonly, ' ')
+			}
+			if arg.Type != nil {
+				p.print(arg.Type, ' ')
+			}
 			p.print(arg.Name)
 			if arg.X != nil {
 				p.print(' ', token.Assign, ' ', arg.X)
 			}
 			p.print(token.Semicolon)
 			if arg.Comment != "" {
-				p.print(' ', arg.Comment)
+				p.print(sep)
+				p.comment(arg.Comment)
 			}
 			p.print(newline)
 		case *FuncDecl:
+			p.attrs(arg.Attrs)
 			if arg.Static {
 				p.print(token.Static, ' ')
 			}
-			p.print(token.Function, ' ', arg.Name, arg.Params)
-			if arg.Result != nil {
-				p.print(token.Colon, ' ', arg.Result)
+			p.print(token.Function, ' ', arg.Name)
+			brace := p.FuncBrace
+			end := []interface{}{resultType{arg.Result}, token.Semicolon}
+			if arg.Body != nil {
+				end[1] = p.braceText(brace)
+			}
+			if p.params(arg.Params, end...) {
+				// PSR-12: The closing parenthesis and the opening
+				// brace of wrapped signatures go together.
+				brace = SameLine
 			}
+			p.print(resultType{arg.Result})
 			if arg.Body != nil {
-				p.print(newline, p.indent, arg.Body)
+				p.body(brace, arg.Body)
 			} else {
 				p.print(token.Semicolon)
 			}
@@ -132,28 +311,48 @@ func (p *printer) print(args ...interface{}) {
 				if i > 0 {
 					p.print(token.Comma, ' ')
 				}
-				if par.Type != nil {
-					p.print(par.Type, ' ')
-				}
-				if par.ByRef {
-					p.print(token.And)
-				}
-				if par.Variadic {
-					p.print(token.Ellipsis)
-				}
-				p.print(par.Name)
-				if par.Default != nil {
-					p.print(' ', token.Assign, ' ', par.Default)
-				}
+				p.print(par)
 			}
 			p.print(token.Rparen)
+		case *Param:
+			for _, g := range arg.Attrs {
+				p.print(g, ' ')
+			}
+			p.print(arg.Vis)
+			if arg.Readonly {
+				p.print(token.Readonly, ' ')
+			}
+			if arg.Type != nil {
+				p.print(arg.Type, ' ')
+			}
+			if arg.ByRef {
+				p.print(token.And)
+			}
+			if arg.Variadic {
+				p.print(token.Ellipsis)
+			}
+			p.print(arg.Name)
+			if arg.Default != nil {
+				p.constExpr = true
+				p.print(' ', token.Assign, ' ', arg.Default)
+				p.constExpr = false
+			}
 		case *ClassDecl:
+			if p.nl > 0 {
+				// Anonymous classes might start a line of
+				// an expression.
+				p.print(p.indent)
+			}
+			p.attrs(arg.Attrs)
 			if arg.Abstract {
 				p.print(token.Abstract, ' ')
 			} else if arg.Final {
 				p.print(token.Final, ' ')
 			}
-			p.print(p.indent, token.Class)
+			if arg.Readonly {
+				p.print(token.Readonly, ' ')
+			}
+			p.print(token.Class)
 			if arg.Name != "" {
 				p.print(' ', arg.Name)
 			}
@@ -167,11 +366,9 @@ func (p *printer) print(args ...interface{}) {
 				}
 			}
 			if arg.Name != "" {
-				p.print(newline, p.indent)
+				p.brace(p.ClassBrace)
 			} else {
-				// Like anonymous functions, anonymous classes have
-				// the Lbrace on the same line.
-				p.print(' ')
+				p.brace(p.AnonClassBrace)
 			}
 			p.print(token.Lbrace, newline)
 			for _, t := range arg.Traits {
@@ -182,29 +379,93 @@ func (p *printer) print(args ...interface{}) {
 			}
 			p.print(arg.Members, p.indent-1, token.Rbrace)
 		case *InterfaceDecl:
+			p.attrs(arg.Attrs)
 			p.print(token.Interface, ' ', arg.Name)
 			if arg.Extends != nil {
 				p.print(' ', token.Extends, ' ', arg.Extends)
 			}
-			p.print(newline, token.Lbrace, newline, arg.Members)
+			p.brace(p.ClassBrace)
+			p.print(token.Lbrace, newline, arg.Members)
 			p.print(p.indent-1, token.Rbrace, newline)
 		case *TraitDecl:
+			p.attrs(arg.Attrs)
 			p.print(token.Trait, ' ', arg.Name)
-			p.print(newline, token.Lbrace, newline, arg.Members)
+			p.brace(p.ClassBrace)
+			p.print(token.Lbrace, newline, arg.Members)
 			p.print(p.indent-1, token.Rbrace, newline)
+		case *EnumDecl:
+			p.attrs(arg.Attrs)
+			p.print(token.Enum, ' ', arg.Name)
+			if arg.Type != nil {
+				p.print(token.Colon, ' ', arg.Type)
+			}
+			if len(arg.Implements) > 0 {
+				p.print(' ', token.Implements, ' ', arg.Implements[0])
+				for _, n := range arg.Implements[1:] {
+					p.print(token.Comma, ' ', n)
+				}
+			}
+			p.brace(p.ClassBrace)
+			p.print(token.Lbrace, newline)
+			for _, t := range arg.Traits {
+				p.print(p.indent, t, newline)
+			}
+			if len(arg.Traits) > 0 {
+				p.print(newline)
+			}
+			p.print(arg.Members, p.indent-1, token.Rbrace, newline)
+		case *EnumCase:
+			sep := p.commentSep()
+			p.print(token.Case, ' ', arg.Name)
+			if arg.X != nil {
+				p.print(' ', token.Assign, ' ', arg.X)
+			}
+			p.print(token.Semicolon)
+			if arg.Comment != "" {
+				p.print(sep)
+				p.comment(arg.Comment)
+			}
+			p.print(newline)
 		case []Member:
-			for i, m := range arg {
-				if i > 0 {
+			var prev Member
+			blank := false
+			for _, m := range arg {
+				if _, ok := m.(*BlankLine); ok {
+					blank = true
+					continue
+				}
+				// Methods are always separated.
+				if prev != nil && (blank || isMethod(prev) || isMethod(m)) {
 					p.print(newline)
 				}
+				prev, blank = m, false
 				// TODO: Refactor handling indentation.
 				switch m := m.(type) {
 				case *ClassMemberDecl:
-					p.print(m.Doc, p.indent, m.Vis, m.Decl)
+					p.print(m.Doc, p.indent)
+					if c := p.nodeComments(m); c != nil {
+						p.leadingComments(c.Leading, true)
+					}
+					p.attrs(m.Attrs)
+					p.cells = p.lineKind(m, p.indent) != plainLine
+					p.print(m.Vis, m.Decl)
+					p.cells = false
 				case *CommentStmt:
 					p.print(p.indent, m, newline)
+				case *UseStmt:
+					// Uses of traits (see ParseMember).
+					p.print(p.indent, m, newline)
+				}
+			}
+		case *AttrGroup:
+			p.print("#[")
+			for i, x := range arg.List {
+				if i > 0 {
+					p.print(token.Comma, ' ')
 				}
+				p.print(x)
 			}
+			p.print(token.Rbrack)
 		case Vis:
 			switch arg {
 			case Public:
@@ -219,33 +480,74 @@ func (p *printer) print(args ...interface{}) {
 				p.err = fmt.Errorf("unknown visibility: %v", arg)
 			}
 		case *CommentStmt:
-			p.print(arg.Text)
+			p.comment(arg.Text)
+		case *InlineHTMLStmt:
+			p.closeTag()
+			text := arg.Text
+			if s := trimNewline(text); p.closed && s != text {
+				// PHP skips the line break right after ?>,
+				// so it can end with any line ending.
+				p.print(newline)
+				text = s
+			}
+			p.literal(text)
+			p.nextOneLine = arg.OneLinePHP
+		case *HaltCompilerStmt:
+			p.print(token.HaltCompiler, token.Lparen, token.Rparen)
+			if d := arg.Data; d == "" || d[0] == '\n' || strings.HasPrefix(d, "\r\n") {
+				p.print(token.Semicolon)
+			} else {
+				// Put the data on a separate line. The newline
+				// right after ?> isn't part of the data.
+				p.print(' ', token.CloseTag, newline)
+			}
+			p.data = arg.Data
+		case *EchoTagStmt:
+			p.closeTag()
+			p.print(token.EchoTag, ' ', arg.X, ' ', token.CloseTag)
+			p.closed = true
+			p.nextOneLine = arg.OneLinePHP
 		case *BlockStmt:
-			p.print(token.Lbrace, newline)
-			for _, stmt := range arg.List {
-				indent := p.indent
-				if _, ok := stmt.(*CaseLabel); ok {
-					indent -= 1
-				}
-				p.print(indent, stmt, newline)
+			p.print(token.Lbrace)
+			if arg.Comment != "" {
+				p.print(' ')
+				p.comment(arg.Comment)
 			}
+			p.print(newline)
+			p.stmts(arg.List)
 			p.print(p.indent-1, token.Rbrace)
 		case *IfStmt:
 			p.print(token.If, ' ', token.Lparen)
 			p.print(arg.Cond)
-			p.print(token.Rparen, ' ', arg.Body)
+			p.print(token.Rparen)
+			if arg.Alt {
+				p.altIf(arg)
+				break
+			}
+			p.body(p.ControlBrace, arg.Body)
 			if arg.Else != nil {
-				p.print(' ', token.Else)
-				// Is it elseif?
-				if _, ok := arg.Else.(*IfStmt); !ok {
-					p.print(' ')
+				p.clause(arg.Body, token.Else, arg.Else)
+				if _, ok := arg.Else.(*IfStmt); ok {
+					// The scanner splits elseif into else
+					// and if.
+					if p.ElseIf == SplitElseIf {
+						p.print(' ')
+					}
+					p.print(arg.Else)
+				} else {
+					p.body(p.ControlBrace, arg.Else)
 				}
-				p.print(arg.Else)
 			}
 		case *SwitchStmt:
 			p.print(token.Switch, ' ', token.Lparen)
 			p.print(arg.Tag)
-			p.print(token.Rparen, ' ', arg.Body)
+			p.print(token.Rparen)
+			if arg.Alt {
+				p.altBody(arg.Body)
+				p.print(token.Endswitch, token.Semicolon)
+				break
+			}
+			p.body(p.ControlBrace, arg.Body)
 		case *CaseLabel:
 			if arg.Matches == nil {
 				p.print(token.Default)
@@ -266,63 +568,182 @@ func (p *printer) print(args ...interface{}) {
 			if arg.Post != nil {
 				p.print(' ', arg.Post)
 			}
-			p.print(token.Rparen, ' ', arg.Body)
+			p.print(token.Rparen)
+			if arg.Alt {
+				p.altBody(arg.Body)
+				p.print(token.Endfor, token.Semicolon)
+				break
+			}
+			p.body(p.ControlBrace, arg.Body)
 		case *TryStmt:
-			p.print(token.Try, ' ', arg.Body)
+			p.print(token.Try)
+			p.body(p.ControlBrace, arg.Body)
 			for _, c := range arg.Catches {
-				p.print(' ', token.Catch, ' ', token.Lparen, c.Cond, token.Rparen)
-				p.print(' ', c.Body)
+				p.clause(arg.Body, token.Catch, c)
+				p.print(' ', token.Lparen, c.Cond, token.Rparen)
+				p.body(p.ControlBrace, c.Body)
+			}
+			if arg.Finally != nil {
+				prev := arg.Body
+				if n := len(arg.Catches); n > 0 {
+					prev = arg.Catches[n-1].Body
+				}
+				p.clause(prev, token.Finally, arg.Finally)
+				p.body(p.ControlBrace, arg.Finally)
 			}
 		case *UnknownStmt:
+			cells := p.cells
+			sep := p.commentSep()
 			if arg.Doc != nil {
 				p.print(arg.Doc, p.indent)
 			}
-			p.print(arg.X)
-			if arg.Body != nil {
-				p.print(' ', arg.Body)
+			x := arg.X
+			if u, ok := x.(*UnknownExpr); ok && cells {
+				if elems := assignCell(u.Elems); elems != nil {
+					x = &UnknownExpr{elems}
+				}
+			}
+			p.print(x)
+			if arg.Alt {
+				p.altBody(arg.Body)
+				p.print(endKeyword(arg.X), token.Semicolon)
+			} else if arg.Body != nil {
+				p.body(p.ControlBrace, arg.Body)
+				if arg.While != nil {
+					p.clause(arg.Body, token.While, arg.While)
+					p.print(' ', arg.While, token.Semicolon)
+				}
 			} else {
 				p.print(token.Semicolon)
 			}
 			if arg.Comment != "" {
-				p.print(' ', arg.Comment)
+				p.print(sep)
+				p.comment(arg.Comment)
 			}
 		case *StaticSelectorExpr:
 			p.print(arg.X, token.DoubleColon, arg.Sel)
 		case *ArrayLit:
-			p.print(token.Lbrack)
+			items := make([]interface{}, len(arg.Elems))
 			for i, elem := range arg.Elems {
-				if i > 0 {
-					p.print(token.Comma, ' ')
+				items[i] = elem
+			}
+			wrap := len(items) > 0 && (p.hasLineComments(items) || !p.fits(arg))
+			p.print(token.Lbrack)
+			if wrap {
+				p.wrap(items, true)
+			} else {
+				for i, elem := range arg.Elems {
+					if i > 0 {
+						p.print(token.Comma, ' ')
+					}
+					p.print(elem)
 				}
-				p.print(elem)
 			}
 			p.print(token.Rbrack)
+		case *HeredocLit:
+			p.print("<<<")
+			if arg.Nowdoc {
+				p.print('\'', arg.Label, '\'')
+			} else {
+				p.print(arg.Label)
+			}
+			// Only heredocs that already had the closing identifier
+			// indented are re-indented, so that the output still
+			// works with PHP < 7.3.
+			var indent indentation
+			if arg.Indented {
+				indent = p.indent + 1
+			}
+			p.print(newline)
+			if n := len(arg.Lines); n > 0 {
+				// The line breaks of the body are a part of the
+				// literal, except for the last one.
+				body := new(strings.Builder)
+				for i, line := range arg.Lines {
+					if line != "" && line != "\r" {
+						body.WriteString(p.indentation(indent))
+					}
+					body.WriteString(line)
+					if i < n-1 {
+						body.WriteByte('\n')
+					}
+				}
+				p.literal(body.String())
+				p.print(newline)
+			}
+			p.print(indent, arg.Label)
 		case *FuncLit:
-			p.print(token.Function, ' ', arg.Params)
+			p.print(token.Function, ' ')
+			brace := p.ClosureBrace
+			var end []interface{}
 			if len(arg.Scope) > 0 {
-				p.print(' ', token.Use, ' ', arg.Scope)
+				end = append(end, ' ', token.Use, ' ', arg.Scope)
 			}
-			if arg.Result != nil {
-				p.print(token.Colon, ' ', arg.Result)
+			end = append(end, resultType{arg.Result}, p.braceText(brace))
+			if p.params(arg.Params, end...) {
+				brace = SameLine
 			}
-			p.print(' ', arg.Body)
-		case *UnknownExpr:
-			for i, elem := range arg.Elems {
-				switch elem := elem.(type) {
-				case token.Token:
-					if i < len(arg.Elems)-1 || elem.Type != token.Whitespace {
-						p.print(elem.Text)
+			p.print(end[:len(end)-1]...)
+			p.body(brace, arg.Body)
+		case *MatchExpr:
+			p.print(token.Match, ' ', token.Lparen, arg.Cond, token.Rparen, ' ')
+			// Keep the arms as they are, including the whitespace
+			// before the closing brace. (Printing braces as strings
+			// keeps the indentation.)
+			p.print(token.Lbrace.String())
+			if arg.Arms != nil {
+				elems := arg.Arms.Elems
+				if p.Align {
+					if a := alignLines(elems); a != nil {
+						elems = a
+					}
+				}
+				for i, elem := range elems {
+					tok, ok := elem.(token.Token)
+					switch {
+					case !ok:
+						p.print(elem)
+					case tok.Type == token.Whitespace:
+						p.space(tok.Text)
+					default:
+						p.text(p.tokenText(elems, i))
 					}
-				default:
-					p.print(elem)
 				}
 			}
+			p.print(token.Rbrace.String())
+		case *UnknownExpr:
+			p.unknownExpr(arg.Elems)
+		case resultType:
+			if arg.Type == nil {
+				continue
+			}
+			switch p.ReturnColon {
+			case SpaceAroundColon:
+				p.print(' ', token.Colon, ' ', arg.Type)
+			case NoSpaceAroundColon:
+				p.print(token.Colon, arg.Type)
+			default:
+				p.print(token.Colon, ' ', arg.Type)
+			}
 		case *Type:
 			if arg.Nullable {
 				p.print(token.Qmark)
 			}
-			p.print(arg.Name)
+			p.print(typeName(arg.Name))
+			for _, n := range arg.Union {
+				p.print(token.Or, typeName(n))
+			}
+			for _, n := range arg.Intersection {
+				p.print(token.And, typeName(n))
+			}
 		case *Name:
+			if p.constExpr && isConstName(arg) {
+				if arg.Global {
+					p.print(token.Backslash)
+				}
+				p.print(p.constText(arg.Parts[0]))
+				continue
+			}
 			for i, part := range arg.Parts {
 				if i > 0 || arg.Global {
 					p.print(token.Backslash)
@@ -335,8 +756,18 @@ func (p *printer) print(args ...interface{}) {
 			}
 			doc := new(phpdoc.Block)
 			*doc = *arg
-			doc.Indent = strings.Repeat("\t", int(p.indent))
-			p.err = phpdoc.Fprint(p.buf, doc)
+			doc.Indent = p.indentation(p.indent)
+			if p.measure {
+				// Doc comments take up whole lines.
+				p.err = errLineEnd
+				continue
+			}
+			buf := new(strings.Builder)
+			if p.err = phpdoc.Fprint(buf, doc); p.err != nil {
+				continue
+			}
+			p.text(buf.String())
+			p.col, p.nl = 0, 1
 		case token.Type:
 			switch arg {
 			case token.Lbrace:
@@ -344,116 +775,1379 @@ func (p *printer) print(args ...interface{}) {
 			case token.Rbrace:
 				p.indent--
 			}
-			_, p.err = p.buf.WriteString(arg.String())
+			p.write(arg.String())
 		case string:
-			_, p.err = p.buf.WriteString(arg)
+			p.write(arg)
 		case rune:
-			_, p.err = p.buf.WriteRune(arg)
+			p.write(string(arg))
 		case indentation:
-			for i := 0; i < int(arg); i++ {
-				p.buf.WriteByte('\t')
-			}
+			p.write(p.indentation(arg))
 		case whitespace:
-			p.err = p.buf.WriteByte(byte(arg))
+			switch arg {
+			case newline:
+				p.write("\n")
+			case tabesc:
+				// Takes up no column.
+				p.err = p.buf.WriteByte(byte(arg))
+			default:
+				p.write(string(arg))
+			}
 		default:
 			p.err = fmt.Errorf("unsupported type %T", arg)
 		}
 	}
 }
 
-// The following is taken from https://golang.org/src/go/printer/printer.go.
-//
-// Copyright (c) 2009 The Go Authors. All rights reserved.
-//
-// Redistribution and use in source and binary forms, with or without
-// modification, are permitted provided that the following conditions are
-// met:
-//
-//    * Redistributions of source code must retain the above copyright
-// notice, this list of conditions and the following disclaimer.
-//    * Redistributions in binary form must reproduce the above
-// copyright notice, this list of conditions and the following disclaimer
-// in the documentation and/or other materials provided with the
-// distribution.
-//    * Neither the name of Google Inc. nor the names of its
-// contributors may be used to endorse or promote products derived from
-// this software without specific prior written permission.
-//
-// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
-// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
-// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
-// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
-// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
-// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
-// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
-// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
-// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
-// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
-// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+// attrs prints the attribute groups of a declaration, each on its own
+// line.
+func (p *printer) attrs(list []*AttrGroup) {
+	for _, g := range list {
+		p.print(g, newline, p.indent)
+	}
+}
 
-// A trimmer is an io.Writer filter for stripping tabwriter.Escape
-// characters, trailing blanks and tabs, and for converting formfeed
-// and vtab characters into newlines and htabs (in case no tabwriter
-// is used). Text bracketed by tabwriter.Escape characters is passed
-// through unchanged.
-type trimmer struct {
-	output io.Writer
-	state  int
-	space  []byte
+// stmtIndent returns the indentation of stmt in a list of statements
+// indented by indent. It sets *inCase after a case label.
+func (c *Config) stmtIndent(stmt Stmt, indent indentation, inCase *bool) indentation {
+	if _, ok := stmt.(*CaseLabel); ok {
+		*inCase = true
+		if !c.IndentCase {
+			return indent - 1
+		}
+	} else if *inCase && c.IndentCase {
+		// The statements of case clauses.
+		return indent + 1
+	}
+	return indent
 }
 
-// trimmer is implemented as a state machine.
-// It can be in one of the following states:
-const (
-	inSpace  = iota // inside space
-	inEscape        // inside text bracketed by tabwriter.Escapes
-	inText          // inside text
-)
+// stmts prints the statements of a block, one level deeper than the
+// opening brace.
+func (p *printer) stmts(list []Stmt) {
+	kinds := p.lineKinds(list, p.indent)
+	inCase := false
+	for i, stmt := range list {
+		if _, ok := stmt.(*BlankLine); ok {
+			if !p.html && p.nl < 2 {
+				p.print(newline)
+			}
+			continue
+		}
+		p.openTag(stmt)
+		if p.html {
+			p.print(stmt)
+			continue
+		}
+		indent := p.stmtIndent(stmt, p.indent, &inCase)
+		p.indent, indent = indent, p.indent
+		p.cells = kinds[i] != plainLine
+		p.print(p.indent, stmt)
+		p.cells = false
+		p.indent = indent
+		if !p.html {
+			next := plainLine
+			if i+1 < len(kinds) {
+				next = kinds[i+1]
+			}
+			p.print(lineBreak(kinds[i], next))
+		}
+	}
+	p.openTag(nil)
+}
 
-func (p *trimmer) resetSpace() {
-	p.state = inSpace
-	p.space = p.space[0:0]
+// altBody prints the body of a control structure in the alternative
+// syntax, up to the keyword that follows it (e.g. endif), which it
+// leaves to the caller.
+func (p *printer) altBody(body Stmt) {
+	block, ok := body.(*BlockStmt)
+	if !ok {
+		block = &BlockStmt{List: []Stmt{body}}
+	}
+	p.print(token.Colon)
+	if block.Comment != "" {
+		p.print(' ')
+		p.comment(block.Comment)
+	}
+	p.print(newline)
+	p.indent++
+	p.stmts(block.List)
+	p.indent--
+	p.print(p.indent)
 }
 
-var aNewline = []byte("\n")
+// altIf prints the rest of the if statement s in the alternative
+// syntax, after the condition: the body, the elseif and else clauses,
+// and endif.
+func (p *printer) altIf(s *IfStmt) {
+	p.altBody(s.Body)
+	for s.Else != nil {
+		if c := p.lookup(s.Else); c != nil && len(c.Leading) > 0 {
+			p.leadingComments(c.Leading, true)
+			c.Leading = nil
+		}
+		e, ok := s.Else.(*IfStmt)
+		if !ok {
+			p.print(token.Else)
+			p.altBody(s.Else)
+			break
+		}
+		p.print(token.Else, token.If, ' ', token.Lparen, e.Cond, token.Rparen)
+		p.altBody(e.Body)
+		s = e
+	}
+	p.print(token.Endif, token.Semicolon)
+}
 
-func (p *trimmer) Write(data []byte) (n int, err error) {
-	// invariants:
-	// p.state == inSpace:
-	//	p.space is unwritten
-	// p.state == inEscape, inText:
-	//	data[m:n] is unwritten
-	m := 0
-	var b byte
-	for n, b = range data {
-		if b == '\v' {
-			b = '\t' // convert to htab
+// indentation returns the text of n levels of indentation.
+func (p *printer) indentation(n indentation) string {
+	if n <= 0 {
+		return ""
+	}
+	if !p.UseSpaces {
+		return strings.Repeat("\t", int(n))
+	}
+	w := p.IndentWidth
+	if w == 0 {
+		w = 4
+	}
+	return strings.Repeat(" ", int(n)*w)
+}
+
+// brace prints what goes before an opening brace.
+func (p *printer) brace(pl BracePlacement) {
+	if pl == NextLine {
+		p.print(newline, p.indent)
+	} else {
+		p.print(' ')
+	}
+}
+
+// body prints the body of a function or a control structure. Bodies
+// that aren't blocks are always on the same line.
+func (p *printer) body(pl BracePlacement, body Stmt) {
+	if _, ok := body.(*BlockStmt); !ok {
+		pl = SameLine
+	} else if c := p.lookup(body); c != nil && pl == NextLine && !hasLineComment(c.Leading) {
+		// Keep the comments on the line they were on.
+		for _, g := range c.Leading {
+			p.trailingComments(g)
 		}
-		switch p.state {
-		case inSpace:
-			switch b {
-			case '\t', ' ':
-				p.space = append(p.space, b)
-			case '\n', '\f':
-				p.resetSpace() // discard trailing space
-				_, err = p.output.Write(aNewline)
-			case tabwriter.Escape:
-				_, err = p.output.Write(p.space)
-				p.state = inEscape
-				m = n + 1 // +1: skip tabwriter.Escape
-			default:
-				_, err = p.output.Write(p.space)
-				p.state = inText
-				m = n
-			}
-		case inEscape:
-			if b == tabwriter.Escape {
+		c.Leading = nil
+	}
+	p.brace(pl)
+	p.print(body)
+}
+
+// clause prints the keyword of a clause (e.g. else) that follows the
+// body prev of a control structure. The leading comments of node (the
+// clause) go before the keyword.
+func (p *printer) clause(prev Stmt, keyword token.Type, node interface{}) {
+	if c := p.lookup(node); c != nil && len(c.Leading) > 0 {
+		p.print(newline, p.indent)
+		p.leadingComments(c.Leading, true)
+		c.Leading = nil
+		p.print(keyword)
+	} else if _, ok := prev.(*BlockStmt); ok && p.ControlBrace == NextLine {
+		p.print(newline, p.indent, keyword)
+	} else {
+		p.print(' ', keyword)
+	}
+}
+
+// write writes s and keeps track of the current column. When
+// measuring, it stops at the end of the line.
+func (p *printer) write(s string) {
+	if p.lineComment && s != "" {
+		if s[0] == '\n' || s[0] == '\f' {
+			p.lineComment = false
+		} else if strings.Trim(s, " \t") != "" {
+			// The code that follows would be commented out.
+			p.lineComment = false
+			p.write("\n" + p.indentation(p.indent))
+		}
+	}
+	if p.oneLine {
+		if strings.Trim(s, " \t\n\f") == "" && (p.pendingSpace || strings.ContainsAny(s, "\n\f")) {
+			p.pendingSpace = true
+			return
+		}
+		if p.pendingSpace {
+			p.pendingSpace = false
+			p.write(" ")
+		}
+	}
+	if p.measure {
+		if i := strings.IndexAny(s, "\n\f"); i >= 0 {
+			p.col += p.width(s[:i])
+			p.err = errLineEnd
+			return
+		}
+	}
+	_, p.err = p.buf.WriteString(s)
+	if s != "" {
+		n := len(s) - len(strings.TrimRight(s, "\n\f"))
+		if n == len(s) {
+			p.nl += n
+		} else {
+			p.nl = n
+		}
+	}
+	if i := strings.LastIndexAny(s, "\n\f"); i >= 0 {
+		p.col, s = 0, s[i+1:]
+	}
+	p.col += p.width(s)
+}
+
+// width returns the number of columns s takes up.
+func (c *Config) width(s string) int {
+	n := utf8.RuneCountInString(s) - strings.Count(s, escape)
+	if tabs := strings.Count(s, "\t"); tabs > 0 {
+		n += tabs * (c.tabWidth() - 1)
+	}
+	return n
+}
+
+// tabWidth returns the width of an indentation level.
+func (c *Config) tabWidth() int {
+	if c.IndentWidth == 0 {
+		return 4
+	}
+	return c.IndentWidth
+}
+
+func (p *printer) version() token.Version {
+	if p.Version == 0 {
+		return token.Latest
+	}
+	return p.Version
+}
+
+// errLineEnd stops measuring at the end of a line.
+var errLineEnd = errors.New("end of line")
+
+// fits reports whether args, printed on a single line, fit on the
+// current line. Only the first line counts if args span more.
+func (p *printer) fits(args ...interface{}) bool {
+	if p.LineWidth <= 0 {
+		return true
+	}
+	q := &printer{
+		Config:  p.Config,
+		buf:     bufio.NewWriter(ioutil.Discard),
+		col:     p.col,
+		measure: true,
+		indent:  p.indent,
+		html:    p.html,
+
+		comments: copyComments(p.comments),
+	}
+	q.LineWidth = 0 // don't wrap
+	q.print(args...)
+	return q.col <= p.LineWidth
+}
+
+// braceText returns what follows a function signature on the same line
+// given the brace placement pl.
+func (p *printer) braceText(pl BracePlacement) string {
+	if pl == SameLine {
+		return " {"
+	}
+	return ""
+}
+
+// params prints the parameter list of a function. If the list and
+// end (what follows it) don't fit on the line, each parameter goes on
+// its own line, and params reports true.
+func (p *printer) params(list []*Param, end ...interface{}) bool {
+	items := make([]interface{}, len(list))
+	for i, par := range list {
+		items[i] = par
+	}
+	if len(list) == 0 || !p.hasLineComments(items) && p.fits(append([]interface{}{list}, end...)...) {
+		p.print(list)
+		return false
+	}
+	p.print(token.Lparen)
+	p.wrap(items, p.version() >= token.PHP80)
+	p.print(token.Rparen)
+	return true
+}
+
+// wrap prints each of the items of a list on its own line, one level
+// deeper, and starts a new line for the closing bracket. If comma is
+// set, the last item is followed by a comma as well. Trailing comments
+// go after the commas.
+func (p *printer) wrap(items []interface{}, comma bool) {
+	p.indent++
+	for i, item := range items {
+		var trailing *CommentGroup
+		if c := p.lookup(item); c != nil {
+			trailing, c.Trailing = c.Trailing, nil
+		}
+		if p.Align && (trailing != nil || hasArrow(item)) && p.singleLine(p.indent, item) {
+			if x, ok := item.(*UnknownExpr); ok {
+				if elems := alignLine(x.Elems); elems != nil {
+					item = &UnknownExpr{elems}
+				}
+			}
+			p.cells = true
+		}
+		p.print(newline, p.indent, item)
+		if i < len(items)-1 || comma {
+			p.print(token.Comma)
+		}
+		p.trailingComments(trailing)
+		p.cells = false
+	}
+	p.indent--
+	p.print(newline, p.indent)
+}
+
+// unknownExpr prints the elements of an UnknownExpr. The whitespace
+// between them is kept, unless the expression doesn't fit on the
+// line. Then long fluent method chains get one call per line, and
+// long argument lists and array literals one item per line. So do
+// the ones already broken across lines, so that the output of
+// wrapping is stable.
+func (p *printer) unknownExpr(elems []interface{}) {
+	if p.Align {
+		elems = p.alignArrays(elems)
+	}
+	chain := p.LineWidth > 0 && hasChainBreak(elems) &&
+		(isBrokenChain(elems) || !p.fits(&UnknownExpr{elems}))
+	indent := p.indent
+	defer func() { p.indent = indent }()
+
+	for i := 0; i < len(elems); i++ {
+		tok, ok := elems[i].(token.Token)
+		if !ok {
+			p.print(elems[i])
+			continue
+		}
+		switch {
+		case tok.Type == token.Comment:
+			p.comment(tok.Text)
+		case tok.Type == token.Whitespace:
+			if i < len(elems)-1 && !(chain && isChainBreak(elems, i+1)) {
+				p.space(tok.Text)
+			}
+		case chain && isChainBreak(elems, i):
+			p.indent = indent + 1
+			p.print(newline, p.indent, tok.Text)
+		case tok.Type == token.Lparen && i+2 < len(elems):
+			p.print(tok.Text)
+			args, ok := elems[i+1].(*UnknownExpr)
+			if !ok {
+				continue
+			}
+			end := len(elems)
+			if chain {
+				end = nextChainBreak(elems, i)
+			}
+			items, broken := splitList(args.Elems)
+			if p.LineWidth > 0 && len(items) > 0 && (broken || !p.fits(&UnknownExpr{elems[i:end]})) {
+				p.wrap(items, p.version() >= token.PHP73)
+				i++ // skip the args
+			}
+		case tok.Type == token.Lbrack && !isIndex(elems, i):
+			p.print(tok.Text)
+			j := closingBrack(elems, i)
+			if j < 0 {
+				continue
+			}
+			end := len(elems)
+			if chain {
+				end = nextChainBreak(elems, i)
+			}
+			items, broken := splitList(elems[i+1 : j])
+			if p.LineWidth > 0 && len(items) > 0 && (broken || !p.fits(&UnknownExpr{elems[i:end]})) {
+				p.wrap(items, true)
+				i = j - 1 // print the closing bracket next
+			}
+		case tok.Type == token.String, tok.Type == token.ShellExec:
+			p.literal(tok.Text)
+		default:
+			p.text(p.tokenText(elems, i))
+		}
+	}
+}
+
+// tokenText returns the text of the token elems[i] normalized like
+// NormalizedText does, except that true, false and null are cased
+// according to ConstCase.
+func (p *printer) tokenText(elems []interface{}, i int) string {
+	if tok := elems[i].(token.Token); isConst(elems, i) {
+		return p.constText(tok.Text)
+	}
+	return NormalizedText(elems, i)
+}
+
+// constText returns s, which is true, false or null, cased according
+// to ConstCase.
+func (p *printer) constText(s string) string {
+	switch p.ConstCase {
+	case LowerCase:
+		return strings.ToLower(s)
+	case UpperCase:
+		return strings.ToUpper(s)
+	}
+	return s
+}
+
+// isConstName reports whether n is true, false or null.
+func isConstName(n *Name) bool {
+	if len(n.Parts) != 1 {
+		return false
+	}
+	switch strings.ToLower(n.Parts[0]) {
+	case "true", "false", "null":
+		return true
+	}
+	return false
+}
+
+// NormalizedText returns the text of the token elems[i] of
+// an UnknownExpr normalized the way Fprint normalizes it in every style:
+// casts get the short form (e.g. (integer) becomes (int)), keywords,
+// the prefixes of numbers, true, false and null are lower-cased, and so
+// are built-in types before variables (e.g. the types of the parameters
+// of arrow functions). The names of members and named arguments (e.g.
+// $x->List) and the parts of qualified names are kept.
+func NormalizedText(elems []interface{}, i int) string {
+	tok := elems[i].(token.Token)
+	switch typ := tok.Type; {
+	case typ.IsCast():
+		return typ.String()
+	case typ == token.Int:
+		if len(tok.Text) > 2 && tok.Text[0] == '0' {
+			switch tok.Text[1] {
+			case 'X', 'B', 'O':
+				return "0" + strings.ToLower(tok.Text[1:2]) + tok.Text[2:]
+			}
+		}
+	case typ.IsKeyword(), typ == token.Land, typ == token.Lor:
+		if !isName(elems, i) {
+			return strings.ToLower(tok.Text)
+		}
+	case isConst(elems, i):
+		return strings.ToLower(tok.Text)
+	case typ == token.Ident:
+		if !isName(elems, i) && tokenType(nextElem(elems, i)) == token.Var {
+			if s, ok := BuiltinType(tok.Text); ok {
+				return s
+			}
+		}
+	}
+	return tok.Text
+}
+
+// isConst reports whether elems[i] is true, false or null.
+func isConst(elems []interface{}, i int) bool {
+	tok := elems[i].(token.Token)
+	if tok.Type != token.Ident || isName(elems, i) || tokenType(nextElem(elems, i)) == token.Var {
+		return false
+	}
+	switch strings.ToLower(tok.Text) {
+	case "true", "false", "null":
+		return true
+	}
+	return false
+}
+
+// isName reports whether elems[i] is the name of a member, a named
+// argument, or a part of a qualified name, rather than a keyword or
+// a constant.
+func isName(elems []interface{}, i int) bool {
+	prev, next := tokenType(prevElem(elems, i)), tokenType(nextElem(elems, i))
+	switch {
+	case prev == token.Arrow, prev == token.QmarkArrow, prev == token.DoubleColon:
+		return true
+	case next == token.Backslash:
+		return true
+	case prev == token.Backslash:
+		// A leading backslash makes a global constant (e.g. \NULL).
+		if i < 2 {
+			return false
+		}
+		tok, ok := elems[i-2].(token.Token)
+		return ok && (tok.Type == token.Ident || tok.Type.IsKeyword())
+	}
+	// The args of calls start without the opening parenthesis.
+	return next == token.Colon && (prev == token.Illegal || prev == token.Lparen || prev == token.Comma)
+}
+
+// tokenType returns the type of elem if it's a token, or Illegal.
+func tokenType(elem interface{}) token.Type {
+	if tok, ok := elem.(token.Token); ok {
+		return tok.Type
+	}
+	return token.Illegal
+}
+
+// typeName returns n with the name of a built-in type (e.g. Int)
+// lower-cased.
+func typeName(n *Name) *Name {
+	if n.Global || len(n.Parts) != 1 {
+		return n
+	}
+	if s, ok := BuiltinType(n.Parts[0]); ok && s != n.Parts[0] {
+		return &Name{Parts: []string{s}}
+	}
+	return n
+}
+
+// BuiltinType returns the lower-cased name if name is the name of
+// a built-in type.
+func BuiltinType(name string) (string, bool) {
+	switch s := strings.ToLower(name); s {
+	case "array", "bool", "callable", "false", "float", "int", "iterable",
+		"mixed", "never", "null", "object", "parent", "self", "static",
+		"string", "true", "void":
+		return s, true
+	}
+	return "", false
+}
+
+// Kinds of lines for alignment. Consecutive lines of different kinds
+// are aligned separately, except for the comments that end them (see
+// commentAligner).
+const (
+	plainLine   = iota // not aligned
+	assignLine         // an assignment, maybe followed by a comment
+	commentLine        // other code followed by a comment
+)
+
+// lineKinds returns the kinds of lines the statements in list are
+// printed on (at the given indentation).
+func (p *printer) lineKinds(list []Stmt, indent indentation) []int {
+	kinds := make([]int, len(list))
+	for i, stmt := range list {
+		kinds[i] = p.lineKind(stmt, indent)
+	}
+	return kinds
+}
+
+// lineKind returns the kind of line node (a statement or a member) is
+// printed on. Nodes that take up more lines are not aligned.
+func (p *printer) lineKind(node interface{}, indent indentation) int {
+	if !p.Align {
+		return plainLine
+	}
+	kind := plainLine
+	switch n := node.(type) {
+	case *UnknownStmt:
+		if n.Doc != nil || n.Body != nil {
+			break
+		}
+		if x, ok := n.X.(*UnknownExpr); ok && assignCell(x.Elems) != nil {
+			kind = assignLine
+		} else if n.Comment != "" {
+			kind = commentLine
+		}
+	case *ClassMemberDecl:
+		var comment string
+		switch d := n.Decl.(type) {
+		case *ConstDecl:
+			comment = d.Comment
+		case *VarDecl:
+			comment = d.Comment
+		case *EnumCase:
+			comment = d.Comment
+		}
+		if n.Doc == nil && len(n.Attrs) == 0 && comment != "" {
+			kind = commentLine
+			node = []interface{}{n.Vis, n.Decl}
+		}
+	}
+	if kind != plainLine && !p.singleLine(indent, node) {
+		return plainLine
+	}
+	return kind
+}
+
+// lineBreak returns the line break between lines of the given kinds.
+func lineBreak(kind, next int) whitespace {
+	if kind != plainLine && next != plainLine && kind != next {
+		return formfeed
+	}
+	return newline
+}
+
+// singleLine reports whether node, printed at the given indentation,
+// takes up a single line.
+func (p *printer) singleLine(indent indentation, node interface{}) bool {
+	buf := new(bytes.Buffer)
+	q := &printer{
+		Config: p.Config,
+		buf:    bufio.NewWriter(buf),
+		indent: indent,
+		html:   p.html,
+
+		comments: copyComments(p.comments),
+	}
+	q.Align = false
+	q.col = q.width(q.indentation(indent))
+	if args, ok := node.([]interface{}); ok {
+		q.print(args...)
+	} else {
+		q.print(node)
+	}
+	if q.err != nil || q.buf.Flush() != nil {
+		return false
+	}
+	return !strings.ContainsAny(strings.TrimRight(buf.String(), "\n"), "\n\f")
+}
+
+// assignCell returns a copy of the elements of an assignment with
+// a cell break before the assignment operator, or nil if elems is not
+// an assignment to a variable, a property or an element (e.g. $a[1]).
+func assignCell(elems []interface{}) []interface{} {
+	depth := 0
+	for i, elem := range elems {
+		if d := nesting(elem); d != 0 {
+			depth += d
+			continue
+		}
+		if depth > 0 {
+			continue
+		}
+		tok, ok := elem.(token.Token)
+		switch {
+		case !ok || tok.Type == token.Comment:
+			return nil
+		case tok.Type.IsAssignOp():
+			if i == 0 {
+				return nil
+			}
+			return withCell(elems, i)
+		case tok.Type == token.Whitespace:
+			if i+1 == len(elems) || !isAssignOp(elems[i+1]) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+func isAssignOp(elem interface{}) bool {
+	tok, ok := elem.(token.Token)
+	return ok && tok.Type.IsAssignOp()
+}
+
+// withCell returns a copy of elems with a cell break before elems[i]
+// instead of the whitespace before it.
+func withCell(elems []interface{}, i int) []interface{} {
+	j := i
+	if tok, ok := elems[i-1].(token.Token); ok && tok.Type == token.Whitespace {
+		j = i - 1
+	}
+	cp := append(elems[:j:j], nextcol)
+	return append(cp, elems[i:]...)
+}
+
+// hasArrow reports whether item is a key-value pair (e.g. 'a' => 1).
+func hasArrow(item interface{}) bool {
+	x, ok := item.(*UnknownExpr)
+	return ok && alignLine(x.Elems) != nil
+}
+
+// alignArrays returns elems with the array literals broken across
+// lines aligned (see alignLines), unless they are going to be wrapped.
+func (p *printer) alignArrays(elems []interface{}) []interface{} {
+	var out []interface{}
+	start := 0 // elems[start:] are yet to be copied to out
+	for i := 0; i < len(elems); i++ {
+		tok, ok := elems[i].(token.Token)
+		if !ok || tok.Type != token.Lbrack || isIndex(elems, i) {
+			continue
+		}
+		j := closingBrack(elems, i)
+		if j < 0 {
+			break
+		}
+		list := p.alignArrays(elems[i+1 : j])
+		if items, broken := splitList(list); p.LineWidth == 0 || items == nil || !broken {
+			if a := alignLines(list); a != nil {
+				list = a
+			}
+		}
+		out = append(out, elems[start:i+1]...)
+		out = append(out, list...)
+		start, i = j, j
+	}
+	if start == 0 {
+		return elems
+	}
+	return append(out, elems[start:]...)
+}
+
+// alignLines returns a copy of the elements of a list that starts and
+// ends with a line break (e.g. match arms) with the key-value pairs
+// aligned (see alignLine), or nil. Only the lines at the top level of
+// the list are aligned.
+func alignLines(elems []interface{}) []interface{} {
+	if len(elems) == 0 || !isNewline(elems[0]) || !isNewline(elems[len(elems)-1]) {
+		return nil
+	}
+	out := []interface{}{elems[0]}
+	depth, start := 0, 1
+	for i := 1; i < len(elems); i++ {
+		if !isNewline(elems[i]) {
+			depth += nesting(elems[i])
+			continue
+		}
+		line := elems[start:i]
+		if a := alignLine(line); a != nil && depth == 0 {
+			line = a
+		}
+		out = append(out, line...)
+		out = append(out, elems[i])
+		start = i + 1
+	}
+	return out
+}
+
+// alignLine returns a copy of the elements of a single line of a
+// key-value pair (e.g. 'a' => 1,) with a cell break before the double
+// arrow, and before the comment that ends the line, if any. It returns
+// nil if the line is not a whole key-value pair.
+func alignLine(line []interface{}) []interface{} {
+	depth, arrow := 0, -1
+	for i, elem := range line {
+		switch elem := elem.(type) {
+		case token.Token:
+			if isNewline(elem) {
+				return nil
+			}
+			if elem.Type == token.DoubleArrow && depth == 0 && arrow < 0 {
+				arrow = i
+			}
+		case string:
+		case *UnknownExpr:
+			if hasNewline(elem.Elems) {
+				return nil
+			}
+		default:
+			// Multi-line nodes, or cell breaks.
+			return nil
+		}
+		if depth += nesting(elem); depth < 0 {
+			return nil
+		}
+	}
+	if arrow <= 0 || depth != 0 {
+		return nil
+	}
+	line = withCell(line, arrow)
+	if n := len(line); n > 2 {
+		if tok, ok := line[n-1].(token.Token); ok && tok.Type == token.Comment {
+			line = withCell(line, n-1)
+		}
+	}
+	return line
+}
+
+// nesting returns 1 if elem opens a bracket, -1 if it closes one, and 0
+// otherwise. (The args of calls are closed by strings; see
+// parseUnknownExpr.)
+func nesting(elem interface{}) int {
+	switch elem := elem.(type) {
+	case token.Token:
+		switch elem.Type {
+		case token.Lparen, token.Lbrack, token.Lbrace:
+			return 1
+		case token.Rparen, token.Rbrack, token.Rbrace:
+			return -1
+		}
+	case string:
+		if elem == ")" || elem == "}" {
+			return -1
+		}
+	}
+	return 0
+}
+
+// hasNewline reports whether elems might be printed on more than one
+// line.
+func hasNewline(elems []interface{}) bool {
+	for _, elem := range elems {
+		switch elem := elem.(type) {
+		case token.Token:
+			if isNewline(elem) || elem.Type == token.Comment && isLineComment(elem.Text) {
+				return true
+			}
+		case *UnknownExpr:
+			if hasNewline(elem.Elems) {
+				return true
+			}
+		case string:
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// isChainBreak reports whether a line break fits before elems[i] in
+// a fluent method chain, i.e. whether it's an arrow right after
+// a call.
+func isChainBreak(elems []interface{}, i int) bool {
+	tok, ok := elems[i].(token.Token)
+	if !ok || tok.Type != token.Arrow && tok.Type != token.QmarkArrow {
+		return false
+	}
+	return isRparen(prevElem(elems, i))
+}
+
+func hasChainBreak(elems []interface{}) bool {
+	return nextChainBreak(elems, -1) < len(elems)
+}
+
+// isBrokenChain reports whether a method chain is already broken
+// across lines.
+func isBrokenChain(elems []interface{}) bool {
+	for i := 1; i < len(elems); i++ {
+		if isChainBreak(elems, i) && isNewline(elems[i-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// isNewline reports whether elem is whitespace with a newline.
+func isNewline(elem interface{}) bool {
+	tok, ok := elem.(token.Token)
+	return ok && tok.Type == token.Whitespace && strings.Contains(tok.Text, "\n")
+}
+
+// nextChainBreak returns the index of the first chain break after
+// elems[i], or len(elems).
+func nextChainBreak(elems []interface{}, i int) int {
+	for i++; i < len(elems); i++ {
+		if isChainBreak(elems, i) {
+			return i
+		}
+	}
+	return len(elems)
+}
+
+// prevElem returns the element before elems[i], skipping whitespace,
+// or nil.
+func prevElem(elems []interface{}, i int) interface{} {
+	for i--; i >= 0; i-- {
+		if tok, ok := elems[i].(token.Token); !ok || tok.Type != token.Whitespace {
+			return elems[i]
+		}
+	}
+	return nil
+}
+
+// nextElem returns the element after elems[i], skipping whitespace,
+// or nil.
+func nextElem(elems []interface{}, i int) interface{} {
+	for i++; i < len(elems); i++ {
+		if tok, ok := elems[i].(token.Token); !ok || tok.Type != token.Whitespace {
+			return elems[i]
+		}
+	}
+	return nil
+}
+
+// isRparen reports whether elem closes an argument list. (Non-empty
+// lists are closed by a string; see parseUnknownExpr.)
+func isRparen(elem interface{}) bool {
+	switch elem := elem.(type) {
+	case token.Token:
+		return elem.Type == token.Rparen
+	case string:
+		return elem == ")"
+	}
+	return false
+}
+
+// isIndex reports whether the bracket elems[i] starts an index (e.g.
+// $a[0]) rather than an array literal.
+func isIndex(elems []interface{}, i int) bool {
+	switch prev := prevElem(elems, i).(type) {
+	case token.Token:
+		switch prev.Type {
+		case token.Var, token.Ident, token.String, token.Rbrack, token.Rbrace, token.Rparen:
+			return true
+		}
+	case string:
+		return prev == ")"
+	}
+	return false
+}
+
+// closingBrack returns the index of the bracket that closes elems[i],
+// or -1.
+func closingBrack(elems []interface{}, i int) int {
+	depth := 0
+	for ; i < len(elems); i++ {
+		tok, ok := elems[i].(token.Token)
+		if !ok {
+			continue
+		}
+		switch tok.Type {
+		case token.Lbrack:
+			depth++
+		case token.Rbrack:
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// splitList splits the elements of a comma-separated list into items
+// without the surrounding whitespace. A trailing comma is dropped. It
+// returns nil for lists that are not safe to wrap, i.e. lists with
+// comments or empty items (e.g. [, $b] = $a). broken reports whether
+// the list is broken across lines (not counting nested lists).
+func splitList(elems []interface{}) (items []interface{}, broken bool) {
+	depth, start := 0, 0
+	for i, elem := range elems {
+		tok, ok := elem.(token.Token)
+		if !ok {
+			continue
+		}
+		switch tok.Type {
+		case token.Comment, token.DocComment:
+			return nil, false
+		case token.Whitespace:
+			broken = broken || depth == 0 && isNewline(tok)
+		case token.Lbrack:
+			depth++
+		case token.Rbrack:
+			depth--
+		case token.Comma:
+			if depth > 0 {
+				break
+			}
+			item := trimSpace(elems[start:i])
+			if len(item) == 0 {
+				return nil, false
+			}
+			items = append(items, &UnknownExpr{item})
+			start = i + 1
+		}
+	}
+	if item := trimSpace(elems[start:]); len(item) > 0 {
+		items = append(items, &UnknownExpr{item})
+	}
+	return items, broken
+}
+
+func trimSpace(elems []interface{}) []interface{} {
+	isSpace := func(elem interface{}) bool {
+		tok, ok := elem.(token.Token)
+		return ok && tok.Type == token.Whitespace
+	}
+	for len(elems) > 0 && isSpace(elems[0]) {
+		elems = elems[1:]
+	}
+	for len(elems) > 0 && isSpace(elems[len(elems)-1]) {
+		elems = elems[:len(elems)-1]
+	}
+	return elems
+}
+
+// copyComments returns a copy of m that can be changed (e.g. by
+// nodeComments) without changing m.
+func copyComments(m CommentMap) CommentMap {
+	if len(m) == 0 {
+		return nil
+	}
+	cp := make(CommentMap, len(m))
+	for node, c := range m {
+		c := *c
+		cp[node] = &c
+	}
+	return cp
+}
+
+// lookup returns the comments of node that are yet to be printed, or
+// nil.
+func (p *printer) lookup(node interface{}) *Comments {
+	if len(p.comments) == 0 {
+		return nil
+	}
+	switch node.(type) {
+	case []*Param, []Member:
+		// Not comparable (and never has comments).
+		return nil
+	}
+	return p.comments[node]
+}
+
+// nodeComments is like lookup, but it forgets the comments so that
+// they are printed only once.
+func (p *printer) nodeComments(node interface{}) *Comments {
+	c := p.lookup(node)
+	if c != nil {
+		delete(p.comments, node)
+	}
+	return c
+}
+
+// hasLineComments reports whether any of the items has a line
+// comment, which forces the list to be wrapped.
+func (p *printer) hasLineComments(items []interface{}) bool {
+	for _, item := range items {
+		c := p.lookup(item)
+		if c == nil {
+			continue
+		}
+		if hasLineComment(c.Leading) || c.Trailing != nil && hasLineComment([]*CommentGroup{c.Trailing}) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasLineComment(groups []*CommentGroup) bool {
+	for _, g := range groups {
+		for _, c := range g.List {
+			if isLineComment(c.Text) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// leadingComments prints comments that go before a node. Line comments
+// are followed by a newline, the others by a space, unless ownLine is
+// set.
+func (p *printer) leadingComments(groups []*CommentGroup, ownLine bool) {
+	eol := false // the previous comment ended the line
+	for _, g := range groups {
+		if eol {
+			// Keep the groups on separate lines apart.
+			p.print(newline, p.indent)
+		}
+		for _, c := range g.List {
+			p.comment(c.Text)
+			if eol = ownLine || isLineComment(c.Text); eol {
+				p.print(newline, p.indent)
+			} else {
+				p.print(' ')
+			}
+		}
+	}
+}
+
+// trailingComments prints comments that go after a node on the same
+// line.
+func (p *printer) trailingComments(g *CommentGroup) {
+	if g == nil {
+		return
+	}
+	sep := p.commentSep()
+	for _, c := range g.List {
+		p.print(sep)
+		p.comment(c.Text)
+		sep = ' '
+	}
+}
+
+// commentSep returns what separates a trailing comment from the code
+// before it: commentCell if the line is aligned with its neighbors.
+// Only one comment on the line gets it.
+func (p *printer) commentSep() interface{} {
+	if p.cells {
+		p.cells = false
+		return commentCell
+	}
+	return ' '
+}
+
+// commentCell separates the trailing comments of aligned lines from
+// the code. It's escaped, so the tabwriter keeps it as it is.
+const commentCell = escape + "\x00" + escape
+
+// A commentAligner is an io.Writer filter for aligning the trailing
+// comments of consecutive lines, which are marked with commentCell.
+// The tabwriter can't align them, as the code before them might be
+// split into different cells (e.g. in assignments and in calls).
+type commentAligner struct {
+	*Config
+	output io.Writer
+	line   []byte   // unfinished
+	escape bool     // inside text bracketed by tabwriter.Escapes
+	run    [][]byte // consecutive lines with comments
+}
+
+func (a *commentAligner) Write(data []byte) (n int, err error) {
+	for i, b := range data {
+		switch {
+		case b == tabwriter.Escape:
+			a.escape = !a.escape
+		case b == '\n' && !a.escape:
+			// The trimmer expects escaped text in one piece.
+			a.line = append(a.line, data[n:i+1]...)
+			n = i + 1
+			if err := a.endLine(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	a.line = append(a.line, data[n:]...)
+	return len(data), nil
+}
+
+// endLine writes the current line, or keeps it pending if it has
+// a comment to align.
+func (a *commentAligner) endLine() error {
+	line := a.line
+	a.line = nil
+	if bytes.Contains(line, []byte(commentCell)) {
+		a.run = append(a.run, line)
+		return nil
+	}
+	if err := a.flush(); err != nil {
+		return err
+	}
+	_, err := a.output.Write(line)
+	return err
+}
+
+// flush writes the pending lines with their comments aligned.
+func (a *commentAligner) flush() error {
+	max := 0
+	for _, line := range a.run {
+		i := bytes.Index(line, []byte(commentCell))
+		if w := a.columns(string(line[:i])); w > max {
+			max = w
+		}
+	}
+	for _, line := range a.run {
+		i := bytes.Index(line, []byte(commentCell))
+		code, comment := string(line[:i]), string(line[i+len(commentCell):])
+		pad := strings.Repeat(" ", max-a.columns(code)+1)
+		if _, err := io.WriteString(a.output, code+pad+comment); err != nil {
+			return err
+		}
+	}
+	a.run = a.run[:0]
+	return nil
+}
+
+// columns returns the number of columns the line s takes up. Unlike
+// width, it expands tabs to the next tab stop.
+func (a *commentAligner) columns(s string) int {
+	n := 0
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case s[i] == tabwriter.Escape:
+			// Takes up no column.
+		case r == '\t':
+			n += a.tabWidth() - n%a.tabWidth()
+		default:
+			n++
+		}
+		i += size
+	}
+	return n
+}
+
+// comment prints the text of a comment. Nothing but a newline can
+// follow a line comment; when measuring, it ends the line.
+func (p *printer) comment(text string) {
+	if isLineComment(text) {
+		// They might end with blanks before ?>.
+		text = strings.TrimRight(text, " \t\r")
+	}
+	p.text(text)
+	if isLineComment(text) {
+		p.lineComment = true
+		if p.measure && p.err == nil {
+			p.err = errLineEnd
+		}
+	}
+}
+
+// text prints the text of a token. The tabs in it (e.g. in strings)
+// are escaped, so that the tabwriter keeps them intact. Line breaks
+// aren't, so that the lines stay lines for the tabwriter.
+func (p *printer) text(s string) {
+	if !strings.ContainsRune(s, '\t') {
+		p.write(s)
+		return
+	}
+	for {
+		i := strings.IndexByte(s, '\n')
+		if i < 0 {
+			break
+		}
+		p.text(s[:i])
+		p.write("\n")
+		s = s[i+1:]
+	}
+	if s != "" {
+		p.write(escape + s + escape)
+	}
+}
+
+// literal prints the text of a literal (e.g. a string) or of inline
+// HTML. The text is escaped, so that the tabs, the trailing whitespace
+// and the line endings in it are kept intact.
+func (p *printer) literal(s string) {
+	if !strings.ContainsAny(s, "\t\r\n") {
+		p.write(s)
+		return
+	}
+	p.write(escape + s + escape)
+}
+
+// space prints whitespace kept from the source. The tabs after the
+// last line break are escaped, so that they aren't taken for cells.
+func (p *printer) space(s string) {
+	i := strings.LastIndexByte(s, '\n') + 1
+	p.write(s[:i])
+	p.text(s[i:])
+}
+
+// isMethod reports whether m is a method with a body.
+func isMethod(m Member) bool {
+	if m, ok := m.(*ClassMemberDecl); ok {
+		fn, ok := m.Decl.(*FuncDecl)
+		return ok && fn.Body != nil
+	}
+	return false
+}
+
+func isHTML(stmt Stmt) bool {
+	switch stmt.(type) {
+	case *InlineHTMLStmt, *EchoTagStmt:
+		return true
+	}
+	return false
+}
+
+// openTag switches back to PHP before printing stmt, unless stmt
+// itself is printed outside of PHP tags. A nil stmt always switches.
+func (p *printer) openTag(stmt Stmt) {
+	if p.html && !isHTML(stmt) {
+		p.oneLine = p.nextOneLine
+		p.print(token.OpenTag, newline)
+		p.html = false
+	}
+}
+
+// closeTag switches to printing outside of PHP tags.
+func (p *printer) closeTag() {
+	if !p.html {
+		if p.oneLine {
+			p.pendingSpace = true
+		}
+		p.print(token.CloseTag)
+		p.html, p.closed = true, true
+		p.oneLine, p.pendingSpace = false, false
+	}
+}
+
+// The following is taken from https://golang.org/src/go/printer/printer.go.
+//
+// Copyright (c) 2009 The Go Authors. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//    * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//    * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//    * Neither the name of Google Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// A trimmer is an io.Writer filter for stripping tabwriter.Escape
+// characters, trailing blanks and tabs, and for converting formfeed
+// and vtab characters into newlines and htabs (in case no tabwriter
+// is used). Text bracketed by tabwriter.Escape characters is passed
+// through unchanged.
+type trimmer struct {
+	output  io.Writer
+	newline []byte
+	state   int
+	space   []byte
+}
+
+// trimmer is implemented as a state machine.
+// It can be in one of the following states:
+const (
+	inSpace  = iota // inside space
+	inEscape        // inside text bracketed by tabwriter.Escapes
+	inText          // inside text
+)
+
+func (p *trimmer) resetSpace() {
+	p.state = inSpace
+	p.space = p.space[0:0]
+}
+
+var (
+	aNewline = []byte("\n")
+	aCRLF    = []byte("\r\n")
+)
+
+func (p *trimmer) Write(data []byte) (n int, err error) {
+	// invariants:
+	// p.state == inSpace:
+	//	p.space is unwritten
+	// p.state == inEscape, inText:
+	//	data[m:n] is unwritten
+	m := 0
+	var b byte
+	for n, b = range data {
+		if b == '\v' {
+			b = '\t' // convert to htab
+		}
+		switch p.state {
+		case inSpace:
+			switch b {
+			case '\t', ' ', '\r':
+				p.space = append(p.space, b)
+			case '\n', '\f':
+				p.resetSpace() // discard trailing space (and \r)
+				_, err = p.output.Write(p.newline)
+			case tabwriter.Escape:
+				_, err = p.output.Write(p.space)
+				p.state = inEscape
+				m = n + 1 // +1: skip tabwriter.Escape
+			default:
+				_, err = p.output.Write(p.space)
+				p.state = inText
+				m = n
+			}
+		case inEscape:
+			switch b {
+			case tabwriter.Escape:
 				_, err = p.output.Write(data[m:n])
 				p.resetSpace()
 			}
 		case inText:
 			switch b {
-			case '\t', ' ':
+			case '\t', ' ', '\r':
 				_, err = p.output.Write(data[m:n])
 				p.resetSpace()
 				p.space = append(p.space, b)
@@ -461,7 +2155,7 @@ func (p *trimmer) Write(data []byte) (n int, err error) {
 				_, err = p.output.Write(data[m:n])
 				p.resetSpace()
 				if err == nil {
-					_, err = p.output.Write(aNewline)
+					_, err = p.output.Write(p.newline)
 				}
 			case tabwriter.Escape:
 				_, err = p.output.Write(data[m:n])
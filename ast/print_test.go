@@ -4,13 +4,14 @@ import (
 	"bytes"
 	"fmt"
 	"io/ioutil"
-	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
 
-	"github.com/mibk/diff"
 	"mibk.dev/php/ast"
+	"mibk.dev/php/internal/linediff"
+	"mibk.dev/php/token"
 )
 
 func TestPrinting(t *testing.T) {
@@ -22,12 +23,15 @@ func TestPrinting(t *testing.T) {
 	for _, file := range files {
 		name := strings.TrimSuffix(filepath.Base(file), ".input")
 		t.Run(name, func(t *testing.T) {
-			f, err := os.Open(file)
+			src, err := ioutil.ReadFile(file)
 			if err != nil {
 				t.Fatal(err)
 			}
-			pf, err := ast.Parse(f)
-			f.Close()
+			cfg, err := testConfig(src)
+			if err != nil {
+				t.Fatalf("%s: %v", file, err)
+			}
+			pf, err := ast.Parse(bytes.NewReader(src))
 			if err != nil {
 				if se, ok := err.(*ast.SyntaxError); ok {
 					err = fmt.Errorf("%s:%d:%d: %v", file, se.Line, se.Column, se.Err)
@@ -36,7 +40,7 @@ func TestPrinting(t *testing.T) {
 			}
 
 			buf := new(bytes.Buffer)
-			if err := ast.Fprint(buf, pf); err != nil {
+			if err := cfg.Fprint(buf, pf); err != nil {
 				t.Fatal(err)
 			}
 
@@ -44,47 +48,267 @@ func TestPrinting(t *testing.T) {
 			if err != nil {
 				t.Fatal(err)
 			}
-			if diff := diffLines(buf.Bytes(), want); diff != "" {
+			if diff := linediff.Lines(buf.Bytes(), want); diff != "" {
 				t.Errorf("files don't match (-got +want)\n%s", diff)
 			}
+
+			// Formatting the output again must change nothing
+			// (e.g. wrapped lists must stay the same).
+			pf, err = ast.Parse(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatalf("reparsing: %v", err)
+			}
+			again := new(bytes.Buffer)
+			if err := cfg.Fprint(again, pf); err != nil {
+				t.Fatal(err)
+			}
+			if diff := linediff.Lines(again.Bytes(), buf.Bytes()); diff != "" {
+				t.Errorf("output isn't stable (-got +want)\n%s", diff)
+			}
 		})
 	}
 }
 
-func diffLines(a, b []byte) string {
-	linesA := bytes.Split(a, []byte("\n"))
-	linesB := bytes.Split(b, []byte("\n"))
-	return diffByteSlices(linesA, linesB, slices{linesA, linesB})
+// testConfig returns the config for printing the test file src. It
+// is Mibk unless src starts with a line like
+//
+//	// config: style=psr12 controlbrace=next
+//
+// after the open tag, which changes the options.
+func testConfig(src []byte) (*ast.Config, error) {
+	cfg := ast.Mibk
+	var header string
+	for _, line := range strings.Split(string(src), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "<?php" || line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "// config:") {
+			header = strings.TrimPrefix(line, "// config:")
+		}
+		break
+	}
+	braces := map[string]ast.BracePlacement{"same": ast.SameLine, "next": ast.NextLine}
+	elseifs := map[string]ast.ElseIfStyle{"join": ast.JoinElseIf, "split": ast.SplitElseIf}
+	cases := map[string]ast.LetterCase{
+		"lower": ast.LowerCase,
+		"upper": ast.UpperCase,
+		"keep":  ast.KeepCase,
+	}
+	colons := map[string]ast.ColonSpacing{
+		"after":  ast.SpaceAfterColon,
+		"around": ast.SpaceAroundColon,
+		"none":   ast.NoSpaceAroundColon,
+	}
+	for _, opt := range strings.Fields(header) {
+		var ok bool
+		key, val := opt, ""
+		if i := strings.IndexByte(opt, '='); i >= 0 {
+			key, val = opt[:i], opt[i+1:]
+		}
+		switch key {
+		case "style":
+			switch val {
+			case "mibk":
+				cfg, ok = ast.Mibk, true
+			case "psr12":
+				cfg, ok = ast.PSR12, true
+			case "zero":
+				cfg, ok = ast.Config{}, true
+			}
+		case "spaces":
+			n, err := strconv.Atoi(val)
+			cfg.UseSpaces, cfg.IndentWidth, ok = true, n, err == nil
+		case "classbrace":
+			cfg.ClassBrace, ok = braces[val]
+		case "funcbrace":
+			cfg.FuncBrace, ok = braces[val]
+		case "closurebrace":
+			cfg.ClosureBrace, ok = braces[val]
+		case "anonclassbrace":
+			cfg.AnonClassBrace, ok = braces[val]
+		case "controlbrace":
+			cfg.ControlBrace, ok = braces[val]
+		case "colon":
+			cfg.ReturnColon, ok = colons[val]
+		case "elseif":
+			cfg.ElseIf, ok = elseifs[val]
+		case "constcase":
+			cfg.ConstCase, ok = cases[val]
+		case "width":
+			n, err := strconv.Atoi(val)
+			cfg.LineWidth, ok = n, err == nil
+		case "align":
+			cfg.Align, ok = true, val == ""
+		case "version":
+			v, err := token.ParseVersion(val)
+			cfg.Version, ok = v, err == nil
+		}
+		if !ok {
+			return nil, fmt.Errorf("bad config option %q", opt)
+		}
+	}
+	return &cfg, nil
+}
+
+// TestComments checks that formatting keeps all the comments, in
+// the same order.
+func TestComments(t *testing.T) {
+	files, err := filepath.Glob("testdata/*.input")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		src, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pf, err := ast.Parse(bytes.NewReader(src))
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		want := comments(src)
+		for _, cfg := range []ast.Config{ast.Mibk, ast.PSR12} {
+			buf := new(bytes.Buffer)
+			if err := cfg.Fprint(buf, pf); err != nil {
+				t.Fatalf("%s: %v", file, err)
+			}
+			if got := comments(buf.Bytes()); !equal(got, want) {
+				t.Errorf("%s: got comments %q, want %q", file, got, want)
+			}
+		}
+	}
+}
+
+// comments returns the text of the comments in src.
+func comments(src []byte) []string {
+	var list []string
+	s := token.NewScanner(bytes.NewReader(src))
+	for {
+		tok := s.Next()
+		if tok.Type == token.EOF {
+			return list
+		}
+		if tok.Type == token.Comment {
+			list = append(list, tok.Text)
+		}
+	}
 }
 
-func diffByteSlices(a, b [][]byte, data diff.Data) string {
-	eds := diff.Diff(data)
-	if len(eds) == 0 {
-		return ""
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
 	}
+	return true
+}
 
-	eds = append(eds, diff.Edit{Index: len(a), Op: diff.None})
-	var i int
-	var buf strings.Builder
-	for _, ed := range eds {
-		for ; i < ed.Index; i++ {
-			fmt.Fprintf(&buf, " %s\n", a[i])
+func TestLineEnding(t *testing.T) {
+	const (
+		lf      = "<p>\n<?php\n$x = <<<EOT\n  a\n  EOT;\n"
+		crlf    = "<p>\r\n<?php\r\n$x = <<<EOT\r\n  a\r\n  EOT;\r\n"
+		lfOut   = "<p>\n<?php\n\n$x = <<<EOT\n\ta\n\tEOT;"
+		crlfOut = "<p>\r\n<?php\r\n\r\n$x = <<<EOT\r\n\ta\r\n\tEOT;"
+	)
+	tests := []struct {
+		input  string
+		ending ast.LineEnding
+		want   string
+	}{
+		{lf, ast.AutoLineEnding, lfOut},
+		{crlf, ast.AutoLineEnding, crlfOut},
+		// The line breaks of literals and inline HTML are kept.
+		{lf, ast.CRLF, "<p>\n<?php\r\n\r\n$x = <<<EOT\r\n\ta\r\n\tEOT;"},
+		{crlf, ast.LF, "<p>\r\n<?php\n\n$x = <<<EOT\n\ta\n\tEOT;"},
+		{
+			"<?php\n$s = 'x\ny';\n$h = <<<EOT\n  a\n  b\n  EOT;\n",
+			ast.CRLF,
+			"<?php\r\n\r\n$s = 'x\ny';\r\n$h = <<<EOT\r\n\ta\n\tb\r\n\tEOT;",
+		},
+		{
+			"<?php\r\n$s = `x\r\ny`;\r\n$h = <<<EOT\r\na\r\n\r\nb\r\nEOT;\r\n",
+			ast.LF,
+			"<?php\n\n$s = `x\r\ny`;\n$h = <<<EOT\na\r\n\r\nb\nEOT;",
+		},
+		{"<?php\r\n$a;\r\n$b;\n", ast.AutoLineEnding, "<?php\r\n\r\n$a;\r\n$b;"},
+		{"<?php\r\n$a;\n$b;\n", ast.AutoLineEnding, "<?php\n\n$a;\n$b;"},
+	}
+	for _, tt := range tests {
+		pf, err := ast.Parse(strings.NewReader(tt.input))
+		if err != nil {
+			t.Fatalf("%q: unexpected err: %v", tt.input, err)
 		}
-		if ed.Op == diff.Delete {
-			fmt.Fprintf(&buf, "-%s\n", a[i])
-			i++
-		} else if ed.Op == diff.Insert {
-			fmt.Fprintf(&buf, "+%s\n", b[ed.Bindex])
+		buf := new(bytes.Buffer)
+		cfg := &ast.Config{LineEnding: tt.ending}
+		if err := cfg.Fprint(buf, pf); err != nil {
+			t.Fatalf("%q: unexpected err: %v", tt.input, err)
+		}
+		if got := buf.String(); got != tt.want {
+			t.Errorf("%q (%d):\n got %q\nwant %q", tt.input, tt.ending, got, tt.want)
 		}
 	}
-	return buf.String()
 }
 
-type slices struct {
-	a, b [][]byte
+func TestNormalizedText(t *testing.T) {
+	x, err := ast.ParseExpr("(INTEGER) 0XFF + Foo::NEW + TRUE + $a->Null + fn(INT $b) => STATIC::ARRAY + 0B11 + \\NULL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	var collect func(elems []interface{})
+	collect = func(elems []interface{}) {
+		for i, e := range elems {
+			switch e := e.(type) {
+			case token.Token:
+				if e.Type != token.Whitespace {
+					got = append(got, ast.NormalizedText(elems, i))
+				}
+			case *ast.UnknownExpr:
+				collect(e.Elems)
+			}
+		}
+	}
+	collect(x.(*ast.UnknownExpr).Elems)
+	want := []string{"(int)", "0xFF", "+", "Foo", "::", "NEW", "+", "true", "+",
+		"$a", "->", "Null", "+", "fn", "(", "int", "$b", "=>", "static", "::", "ARRAY", "+", "0b11", "+", "\\", "null"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
 }
 
-func (d slices) Lens() (n, m int) { return len(d.a), len(d.b) }
-func (d slices) Equal(i, j int) bool {
-	return bytes.Equal(d.a[i], d.b[j])
+func TestFprintKeepsTree(t *testing.T) {
+	const input = `<?php
+namespace \A;
+use \B\C;
+class D { use \E; }`
+	f, err := ast.Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got strings.Builder
+	if err := ast.Fprint(&got, f); err != nil {
+		t.Fatal(err)
+	}
+	want := `<?php
+
+namespace A;
+
+use B\C;
+
+class D
+{
+	use \E;
+
+}
+`
+	if diff := linediff.Lines([]byte(got.String()), []byte(want)); diff != "" {
+		t.Errorf("output doesn't match (-got +want)\n%s", diff)
+	}
+	if !f.Namespace.Global || !f.UseStmts[0].Name.Global {
+		t.Errorf("Fprint modified the names")
+	}
 }
@@ -0,0 +1,189 @@
+package ast
+
+import (
+	"bytes"
+	"strings"
+
+	"mibk.dev/php/token"
+)
+
+// A TextEdit replaces the bytes of a source from Start to End (byte
+// offsets, End exclusive) with New.
+type TextEdit struct {
+	Start, End int
+	New        string
+}
+
+// FprintRange formats the statements, declarations and members of
+// src that overlap the bytes from start to end, and returns the edits
+// that do it, sorted by offset. The rest of src is left intact.
+//
+// A node that overlaps the range without being within it (e.g. a class
+// or a function of which only a part is selected) is not formatted
+// itself if any of the nodes in its body overlap the range; just
+// these are. An empty range selects the nodes around start. Use
+// a token.LineMap to get the offsets of lines.
+func (c *Config) FprintRange(src []byte, start, end int) ([]TextEdit, error) {
+	f, err := Parse(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	if end <= start {
+		end = start + 1
+	}
+	r := &rangePrinter{
+		cfg:   c,
+		src:   src,
+		lines: token.NewLineMap(src),
+		file:  f,
+		start: start,
+		end:   end,
+	}
+	for _, d := range f.Pragmas {
+		r.node(d, 0, false)
+	}
+	for _, u := range f.UseStmts {
+		r.node(u, 0, false)
+	}
+	for _, stmt := range f.Stmts {
+		r.node(stmt, 0, true)
+	}
+	return r.edits, r.err
+}
+
+// A rangePrinter collects the edits of FprintRange.
+type rangePrinter struct {
+	cfg        *Config
+	src        []byte
+	lines      *token.LineMap
+	file       *File
+	start, end int
+
+	edits []TextEdit
+	err   error
+}
+
+// node formats node, an item of a list printed at the given
+// indentation, or the items in its body, if it overlaps the range.
+// top tells whether the list is the statements of the file. It reports
+// whether node overlaps the range.
+func (r *rangePrinter) node(node interface{}, indent indentation, top bool) bool {
+	span, ok := r.file.Spans[node]
+	if !ok || r.err != nil {
+		return false
+	}
+	start, end := r.lines.Offset(span.Start), r.lines.Offset(span.End)
+	if end <= r.start || r.end <= start {
+		return false
+	}
+	switch node.(type) {
+	case *InlineHTMLStmt, *EchoTagStmt, *HaltCompilerStmt:
+		// They are kept as they are anyway.
+		return true
+	}
+	if r.start <= start && end <= r.end || !r.body(node, indent) {
+		r.format(node, indent, top, start, end)
+	}
+	return true
+}
+
+// body formats the items in the body of node that overlap the range
+// and reports whether there were any.
+func (r *rangePrinter) body(node interface{}, indent indentation) bool {
+	switch n := node.(type) {
+	case *ClassMemberDecl:
+		return r.body(n.Decl, indent)
+	case *FuncDecl:
+		return n.Body != nil && r.body(n.Body, indent)
+	case *ClassDecl:
+		return r.members(n.Members, indent+1)
+	case *InterfaceDecl:
+		return r.members(n.Members, indent+1)
+	case *TraitDecl:
+		return r.members(n.Members, indent+1)
+	case *EnumDecl:
+		return r.members(n.Members, indent+1)
+	case *BlockStmt:
+		found, inCase := false, false
+		for _, stmt := range n.List {
+			if r.node(stmt, r.cfg.stmtIndent(stmt, indent+1, &inCase), false) {
+				found = true
+			}
+		}
+		return found
+	case *IfStmt:
+		found := r.body(n.Body, indent)
+		if n.Else != nil && r.body(n.Else, indent) {
+			found = true
+		}
+		return found
+	case *SwitchStmt:
+		return r.body(n.Body, indent)
+	case *ForStmt:
+		return r.body(n.Body, indent)
+	case *TryStmt:
+		found := r.body(n.Body, indent)
+		for _, c := range n.Catches {
+			if r.body(c.Body, indent) {
+				found = true
+			}
+		}
+		if n.Finally != nil && r.body(n.Finally, indent) {
+			found = true
+		}
+		return found
+	case *UnknownStmt:
+		return n.Body != nil && r.body(n.Body, indent)
+	}
+	return false
+}
+
+func (r *rangePrinter) members(list []Member, indent indentation) bool {
+	found := false
+	for _, m := range list {
+		if r.node(m, indent, false) {
+			found = true
+		}
+	}
+	return found
+}
+
+// format formats node, which spans the bytes from start to end, the
+// way the list it's an item of would print it.
+func (r *rangePrinter) format(node interface{}, indent indentation, top bool, start, end int) {
+	buf := new(bytes.Buffer)
+	r.err = r.cfg.fprint(buf, r.file, func(p *printer) {
+		p.indent = indent
+		switch n := node.(type) {
+		case *ClassMemberDecl:
+			p.print(n.Doc, p.indent)
+			if c := p.nodeComments(n); c != nil {
+				p.leadingComments(c.Leading, true)
+			}
+			p.print(n.Vis, n.Decl)
+		case Decl:
+			if top {
+				p.print(n.doc())
+			}
+			p.print(p.indent, n)
+		default:
+			p.print(p.indent, n)
+		}
+	})
+	if r.err != nil {
+		return
+	}
+	text := strings.TrimRight(buf.String(), "\r\n")
+
+	// Replace the indentation too, unless there is code before
+	// the node on its line.
+	line := r.lines.Offset(token.Pos{Line: r.lines.Pos(start).Line, Column: 1})
+	if strings.Trim(string(r.src[line:start]), " \t") == "" {
+		start = line
+	} else {
+		text = strings.TrimLeft(text, " \t")
+	}
+	if text != string(r.src[start:end]) {
+		r.edits = append(r.edits, TextEdit{Start: start, End: end, New: text})
+	}
+}
@@ -0,0 +1,130 @@
+package ast_test
+
+import (
+	"strings"
+	"testing"
+
+	"mibk.dev/php/ast"
+	"mibk.dev/php/internal/linediff"
+	"mibk.dev/php/token"
+)
+
+func TestFprintRange(t *testing.T) {
+	const input = `<?php
+use  Foo\Bar;
+class   C {
+function f( $a ) { // open
+$x=1;
+  $y = Bar::Z;
+if($a){
+   foo($y);
+}
+}
+   public $z   = 1; // c
+}`
+	tests := []struct {
+		name     string
+		from, to int // lines
+		want     string
+	}{
+		{"statement", 6, 6, `<?php
+use  Foo\Bar;
+class   C {
+function f( $a ) { // open
+$x=1;
+		$y = Bar::Z;
+if($a){
+   foo($y);
+}
+}
+   public $z   = 1; // c
+}`},
+		{"statements", 6, 9, `<?php
+use  Foo\Bar;
+class   C {
+function f( $a ) { // open
+$x=1;
+		$y = Bar::Z;
+		if ($a) {
+			foo($y);
+		}
+}
+   public $z   = 1; // c
+}`},
+		{"part of block", 6, 8, `<?php
+use  Foo\Bar;
+class   C {
+function f( $a ) { // open
+$x=1;
+		$y = Bar::Z;
+if($a){
+			foo($y);
+}
+}
+   public $z   = 1; // c
+}`},
+		{"member", 11, 11, `<?php
+use  Foo\Bar;
+class   C {
+function f( $a ) { // open
+$x=1;
+  $y = Bar::Z;
+if($a){
+   foo($y);
+}
+}
+	public $z = 1; // c
+}`},
+		{"header", 4, 4, `<?php
+use  Foo\Bar;
+class   C {
+	function f($a)
+	{ // open
+		$x=1;
+		$y = Bar::Z;
+		if ($a) {
+			foo($y);
+		}
+	}
+   public $z   = 1; // c
+}`},
+		{"use", 1, 2, `<?php
+use Foo\Bar;
+class   C {
+function f( $a ) { // open
+$x=1;
+  $y = Bar::Z;
+if($a){
+   foo($y);
+}
+}
+   public $z   = 1; // c
+}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := []byte(input)
+			m := token.NewLineMap(src)
+			start := m.Offset(token.Pos{Line: tt.from, Column: 1})
+			end := m.Offset(token.Pos{Line: tt.to + 1, Column: 1})
+			edits, err := ast.Mibk.FprintRange(src, start, end)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			var got strings.Builder
+			off := 0
+			for _, e := range edits {
+				if e.Start < off {
+					t.Fatalf("edits overlap or aren't sorted: %v", edits)
+				}
+				got.Write(src[off:e.Start])
+				got.WriteString(e.New)
+				off = e.End
+			}
+			got.Write(src[off:])
+			if diff := linediff.Lines([]byte(got.String()), []byte(tt.want)); diff != "" {
+				t.Errorf("output doesn't match (-got +want)\n%s", diff)
+			}
+		})
+	}
+}
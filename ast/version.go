@@ -0,0 +1,43 @@
+package ast
+
+import (
+	"io"
+	"sort"
+
+	"mibk.dev/php/token"
+)
+
+// A Feature is a piece of syntax that is available only as of a PHP
+// version.
+type Feature struct {
+	Pos     token.Pos
+	Version token.Version
+	Name    string // e.g. "nullsafe operator"
+}
+
+// MinVersion parses a PHP file and reports the lowest PHP version able
+// to run it. It also returns all the features that require a newer
+// version than PHP 7.0, in the order they appear in the file.
+func MinVersion(r io.Reader) (token.Version, []Feature, error) {
+	p := newParser(r)
+	p.parseFile()
+	if p.err != nil {
+		return 0, nil, p.err
+	}
+	min := token.PHP70
+	var features []Feature
+	for _, f := range p.features {
+		if f.Version <= token.PHP70 {
+			continue
+		}
+		if f.Version > min {
+			min = f.Version
+		}
+		features = append(features, f)
+	}
+	sort.SliceStable(features, func(i, j int) bool {
+		pi, pj := features[i].Pos, features[j].Pos
+		return pi.Line < pj.Line || pi.Line == pj.Line && pi.Column < pj.Column
+	})
+	return min, features, nil
+}
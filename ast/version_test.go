@@ -0,0 +1,138 @@
+package ast_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"mibk.dev/php/ast"
+	"mibk.dev/php/token"
+)
+
+func TestMinVersion(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  token.Version
+		feats []string
+	}{{
+		"legacy",
+		"<?php\nfunction f(array $a) { return $a ?? [0x1]; }",
+		token.PHP70,
+		nil,
+	}, {
+		"PHP 7",
+		"<?php\nclass A {\n\tprivate const X = 1_000;\n\tpublic ?int $a;\n\tfunction f(): object {}\n}",
+		token.PHP74,
+		[]string{
+			"3:2: class constant visibility requires PHP 7.1",
+			"3:20: numeric literal separator requires PHP 7.4",
+			"4:9: nullable type requires PHP 7.1",
+			"4:9: typed property requires PHP 7.4",
+			"5:16: object type requires PHP 7.2",
+		},
+	}, {
+		"PHP 8",
+		"<?php\n#[Pure]\nfunction f(int|false $x): static|null { return $x?->y(named: match ($x) { default => fn() => 1 }); }",
+		token.PHP80,
+		[]string{
+			"2:1: attribute requires PHP 8.0",
+			"3:15: union type requires PHP 8.0",
+			"3:27: static type requires PHP 8.0",
+			"3:33: union type requires PHP 8.0",
+			"3:50: nullsafe operator requires PHP 8.0",
+			"3:55: named argument requires PHP 8.0",
+			"3:62: match expression requires PHP 8.0",
+			"3:86: arrow function requires PHP 7.4",
+		},
+	}, {
+		"PHP 8.2",
+		"<?php\nenum E { case A; }\nfunction f(): null {}",
+		token.PHP82,
+		[]string{
+			"2:1: enumeration requires PHP 8.1",
+			"3:15: null type requires PHP 8.2",
+		},
+	}, {
+		"PHP 8.3",
+		"<?php\n#[A]\nreadonly class A {\n\tconst string X = '';\n\tfunction f(#[B] A&B $x) {}\n}",
+		token.PHP83,
+		[]string{
+			"2:1: attribute requires PHP 8.0",
+			"3:1: readonly property requires PHP 8.1",
+			"3:1: readonly class requires PHP 8.2",
+			"4:8: typed class constant requires PHP 8.3",
+			"5:13: attribute requires PHP 8.0",
+			"5:19: intersection type requires PHP 8.1",
+		},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, features, err := ast.MinVersion(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got version %v, want %v", got, tt.want)
+			}
+			var feats []string
+			for _, f := range features {
+				feats = append(feats, f.Pos.String()+": "+f.Name+" requires PHP "+f.Version.String())
+			}
+			if diff := cmp.Diff(feats, tt.feats); diff != "" {
+				t.Errorf("features don't match: (-got +want)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFeatures(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string // features of the last line
+	}{
+		{"f($a, $b);", nil},
+		{"f($a,\n);", []string{"2:5: trailing comma in argument list requires PHP 7.3"}},
+		{"$x = array(1, [2,], list($a,) = $b,);", nil},
+		{"function f($a,) {}", []string{"2:14: trailing comma in parameter list requires PHP 8.0"}},
+		{"$f = function ($a) use ($b,) {};", []string{"2:27: trailing comma in parameter list requires PHP 8.0"}},
+		{"$f = fn($a,) => $a;", []string{
+			"2:6: arrow function requires PHP 7.4",
+			"2:11: trailing comma in parameter list requires PHP 8.0",
+		}},
+		{"try {} catch (A $e) {}", nil},
+		{"try {} catch (A | B $e) {}", []string{"2:17: multi-catch requires PHP 7.1"}},
+		{"try {} catch (A) {}", []string{"2:16: catch without variable requires PHP 8.0"}},
+		{"list($a, $b) = $c; $a[0] = $b[1];", nil},
+		{"[$a, $b] = $c;", []string{"2:1: short list syntax requires PHP 7.1"}},
+		{"foreach ($a as [$b, $c]) {}", []string{"2:16: short list syntax requires PHP 7.1"}},
+		{"f(...$a); $b = [1, f(...$c)];", nil},
+		{"$b = [...$a, 1];", []string{"2:7: array unpacking requires PHP 7.4"}},
+		{"throw new E();", nil},
+		{"$a = $b ?? throw new E();", []string{"2:12: throw expression requires PHP 8.0"}},
+		{"f(throw $e);", []string{"2:3: throw expression requires PHP 8.0"}},
+		{"$f = strlen(...);", []string{"2:13: first-class callable syntax requires PHP 8.1"}},
+		{"(new Foo())->bar(); foo()->bar(); A::b()::c;", nil},
+		{"new Foo()->bar();", []string{"2:10: new without parentheses requires PHP 8.4"}},
+		{"new \\A\\B()::X;", []string{"2:11: new without parentheses requires PHP 8.4"}},
+		{"new class {}->bar();", []string{"2:13: new without parentheses requires PHP 8.4"}},
+	}
+
+	for _, tt := range tests {
+		input := "<?php\n" + tt.input
+		_, features, err := ast.MinVersion(strings.NewReader(input))
+		if err != nil {
+			t.Errorf("%s: unexpected err: %v", tt.input, err)
+			continue
+		}
+		var feats []string
+		for _, f := range features {
+			feats = append(feats, f.Pos.String()+": "+f.Name+" requires PHP "+f.Version.String())
+		}
+		if diff := cmp.Diff(feats, tt.want); diff != "" {
+			t.Errorf("%s: features don't match: (-got +want)\n%s", tt.input, diff)
+		}
+	}
+}
@@ -7,18 +7,52 @@ import (
 	"io"
 	"io/ioutil"
 	"log"
+	"math"
 	"os"
+	"strconv"
 
 	"mibk.dev/php/ast"
+	"mibk.dev/php/format"
+	"mibk.dev/php/token"
 )
 
-var inPlace = flag.Bool("w", false, "write to file")
+var (
+	inPlace = flag.Bool("w", false, "write to file")
+	style   = flag.String("style", "mibk", "coding `style`: mibk or psr12")
+	indent  = flag.String("indent", "", "indentation: tab or the number of spaces (default as in the style)")
+	eol     = flag.String("eol", "", "line ending: lf or crlf (default as in the file)")
+	colon   = flag.String("return-colon", "", "spacing around the colon in return types: after, around or none")
+	elseIf  = flag.String("elseif", "", "else if clauses: join (elseif) or split (else if)")
+	consts  = flag.String("const-case", "", "case of true, false and null: lower, upper or keep")
+	width   = flag.Int("width", -1, "maximum line `width`, 0 for no limit (default as in the style)")
+	align   = flag.Bool("align", false, "align assignments, double arrows and trailing comments")
+	php     = flag.String("php", "", "PHP `version` the output must work with (default latest)")
+	lines   = flag.String("lines", "", "format only the statements on the given `lines`, e.g. 40-80")
+	verify  = flag.Bool("verify", false, "check that formatting keeps the code and is idempotent; don't output anything")
+
+	braces = map[string]*string{
+		"class":      flag.String("class-brace", "", "brace placement for classes: same or next"),
+		"func":       flag.String("func-brace", "", "brace placement for functions and methods: same or next"),
+		"closure":    flag.String("closure-brace", "", "brace placement for anonymous functions: same or next"),
+		"anon-class": flag.String("anon-class-brace", "", "brace placement for anonymous classes: same or next"),
+		"control":    flag.String("control-brace", "", "brace placement for control structures: same or next"),
+	}
+)
+
+var (
+	config           ast.Config
+	fromLine, toLine int
+)
 
 func main() {
 	flag.Parse()
 	log.SetPrefix("phpfmt: ")
 	log.SetFlags(0)
 
+	if err := configure(); err != nil {
+		log.Fatal(err)
+	}
+
 	if flag.NArg() == 0 {
 		if *inPlace {
 			log.Fatal("cannot use -w with standard input")
@@ -29,6 +63,7 @@ func main() {
 		return
 	}
 
+	failed := false
 	for _, filename := range flag.Args() {
 		f, err := os.Open(filename)
 		if err != nil {
@@ -45,6 +80,7 @@ func main() {
 		f.Close()
 		if err != nil {
 			log.Println(err)
+			failed = true
 			continue
 		}
 
@@ -59,14 +95,165 @@ func main() {
 			}
 		}
 	}
+	if failed {
+		os.Exit(1)
+	}
 }
 
 func formatFile(filename string, out io.Writer, in io.Reader) error {
-	file, err := ast.Parse(in)
+	if *lines != "" {
+		return formatLines(filename, out, in)
+	}
+	src, err := ioutil.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	if *verify {
+		if err := format.Verify(src, &config); err != nil {
+			return fileError(filename, err)
+		}
+		return nil
+	}
+	res, err := format.Source(src, &config)
+	if err != nil {
+		return fileError(filename, err)
+	}
+	_, err = out.Write(res)
+	return err
+}
+
+// formatLines is like formatFile, but it formats only the statements
+// on the lines from fromLine to toLine.
+func formatLines(filename string, out io.Writer, in io.Reader) error {
+	src, err := ioutil.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	m := token.NewLineMap(src)
+	start := m.Offset(token.Pos{Line: fromLine, Column: 1})
+	end := m.Offset(token.Pos{Line: toLine, Column: math.MaxInt32}) // clamped
+	res, err := format.Range(src, start, end, &config)
+	if err != nil {
+		return fileError(filename, err)
+	}
+	_, err = out.Write(res)
+	return err
+}
+
+func fileError(filename string, err error) error {
 	if se, ok := err.(*ast.SyntaxError); ok {
 		return fmt.Errorf("%s:%d:%d: %v", filename, se.Line, se.Column, se.Err)
-	} else if err != nil {
-		return err
 	}
-	return ast.Fprint(out, file)
+	return fmt.Errorf("%s: %v", filename, err)
+}
+
+// configure sets config according to the flags. The flags that are
+// set override the options of the style.
+func configure() error {
+	switch *style {
+	case "mibk":
+		config = ast.Mibk
+	case "psr12":
+		config = ast.PSR12
+	default:
+		return fmt.Errorf("unknown style: %s", *style)
+	}
+
+	switch *indent {
+	case "":
+	case "tab":
+		config.UseSpaces = false
+	default:
+		n, err := strconv.Atoi(*indent)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid indentation: %s", *indent)
+		}
+		config.UseSpaces, config.IndentWidth = true, n
+	}
+
+	switch *eol {
+	case "":
+	case "lf":
+		config.LineEnding = ast.LF
+	case "crlf":
+		config.LineEnding = ast.CRLF
+	default:
+		return fmt.Errorf("unknown line ending: %s", *eol)
+	}
+
+	if *width >= 0 {
+		config.LineWidth = *width
+	}
+	if *align {
+		config.Align = true
+	}
+	if *verify && (*inPlace || *lines != "") {
+		return fmt.Errorf("cannot use -verify with -w or -lines")
+	}
+	if *lines != "" {
+		_, err := fmt.Sscanf(*lines, "%d-%d", &fromLine, &toLine)
+		if err != nil || fromLine < 1 || toLine < fromLine {
+			return fmt.Errorf("invalid line range: %s", *lines)
+		}
+	}
+	if *php != "" {
+		v, err := token.ParseVersion(*php)
+		if err != nil {
+			return err
+		}
+		config.Version = v
+	}
+
+	switch *colon {
+	case "":
+	case "after":
+		config.ReturnColon = ast.SpaceAfterColon
+	case "around":
+		config.ReturnColon = ast.SpaceAroundColon
+	case "none":
+		config.ReturnColon = ast.NoSpaceAroundColon
+	default:
+		return fmt.Errorf("unknown return colon spacing: %s", *colon)
+	}
+
+	switch *elseIf {
+	case "":
+	case "join":
+		config.ElseIf = ast.JoinElseIf
+	case "split":
+		config.ElseIf = ast.SplitElseIf
+	default:
+		return fmt.Errorf("unknown else if style: %s", *elseIf)
+	}
+
+	switch *consts {
+	case "":
+	case "lower":
+		config.ConstCase = ast.LowerCase
+	case "upper":
+		config.ConstCase = ast.UpperCase
+	case "keep":
+		config.ConstCase = ast.KeepCase
+	default:
+		return fmt.Errorf("unknown constant case: %s", *consts)
+	}
+
+	for construct, pl := range map[string]*ast.BracePlacement{
+		"class":      &config.ClassBrace,
+		"func":       &config.FuncBrace,
+		"closure":    &config.ClosureBrace,
+		"anon-class": &config.AnonClassBrace,
+		"control":    &config.ControlBrace,
+	} {
+		switch v := *braces[construct]; v {
+		case "":
+		case "same":
+			*pl = ast.SameLine
+		case "next":
+			*pl = ast.NextLine
+		default:
+			return fmt.Errorf("unknown %s brace placement: %s", construct, v)
+		}
+	}
+	return nil
 }
@@ -0,0 +1,86 @@
+// Phpminver reports the lowest PHP version able to run PHP files.
+//
+// For every file, it prints the position of each feature that forces
+// the version up, followed by the minimum version. If the -max flag is
+// given, only features newer than that version are reported, and the
+// exit status is non-zero if there are any.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"mibk.dev/php/ast"
+	"mibk.dev/php/token"
+)
+
+var maxVersion = flag.String("max", "", "report features newer than `version` and fail if any")
+
+func main() {
+	flag.Parse()
+	log.SetPrefix("phpminver: ")
+	log.SetFlags(0)
+
+	var max token.Version // no limit
+	if *maxVersion != "" {
+		v, err := token.ParseVersion(*maxVersion)
+		if err != nil {
+			log.Fatal(err)
+		}
+		max = v
+	}
+
+	if flag.NArg() == 0 {
+		ok, err := checkFile("<stdin>", os.Stdout, os.Stdin, max)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !ok {
+			os.Exit(1)
+		}
+		return
+	}
+
+	exitCode := 0
+	for _, filename := range flag.Args() {
+		f, err := os.Open(filename)
+		if err != nil {
+			log.Fatal(err)
+		}
+		ok, err := checkFile(filename, os.Stdout, f, max)
+		f.Close()
+		if err != nil {
+			log.Println(err)
+			exitCode = 1
+			continue
+		}
+		if !ok {
+			exitCode = 1
+		}
+	}
+	os.Exit(exitCode)
+}
+
+// checkFile reports the features of the file that require a newer
+// version than PHP 7.0, or than max if it is set. It reports whether
+// the file runs on max.
+func checkFile(filename string, out io.Writer, in io.Reader, max token.Version) (ok bool, err error) {
+	min, features, err := ast.MinVersion(in)
+	if se, ok := err.(*ast.SyntaxError); ok {
+		return false, fmt.Errorf("%s:%d:%d: %v", filename, se.Line, se.Column, se.Err)
+	} else if err != nil {
+		return false, err
+	}
+	for _, f := range features {
+		if max == 0 || f.Version > max {
+			fmt.Fprintf(out, "%s:%v: %s requires PHP %v\n", filename, f.Pos, f.Name, f.Version)
+		}
+	}
+	if max == 0 || min > max {
+		fmt.Fprintf(out, "%s: PHP %v\n", filename, min)
+	}
+	return max == 0 || min <= max, nil
+}
@@ -0,0 +1,322 @@
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"mibk.dev/php/ast"
+	"mibk.dev/php/token"
+	"mibk.dev/phpdoc"
+)
+
+// equivalent reports whether the nodes a and b (e.g. files) differ
+// only in what formatting changes: whitespace, blank lines, where the
+// comments are, trailing commas of lists, and the case of keywords,
+// casts, the prefixes of numbers, true, false, null and names. If they
+// don't, the error describes the first difference.
+func equivalent(a, b interface{}) error {
+	var c comparer
+	root := strings.TrimPrefix(fmt.Sprintf("%T", a), "*ast.")
+	if err := c.equal(root, reflect.ValueOf(a), reflect.ValueOf(b)); err != nil {
+		return err
+	}
+	if f, ok := a.(*ast.File); ok {
+		c.commentMap(0, f.Comments)
+	}
+	if f, ok := b.(*ast.File); ok {
+		c.commentMap(1, f.Comments)
+	}
+	x, y := c.comments[0], c.comments[1]
+	sort.Strings(x)
+	sort.Strings(y)
+	for i := 0; i < len(x) || i < len(y); i++ {
+		switch {
+		case i == len(x):
+			return fmt.Errorf("comment %q added", y[i])
+		case i == len(y), x[i] < y[i]:
+			return fmt.Errorf("comment %q lost", x[i])
+		case x[i] > y[i]:
+			return fmt.Errorf("comment %q added", y[i])
+		}
+	}
+	return nil
+}
+
+// A comparer compares syntax trees. The comments can move from node
+// to node, so they are collected to be compared separately.
+type comparer struct {
+	comments [2][]string
+}
+
+var (
+	fileType  = reflect.TypeOf(ast.File{})
+	nameType  = reflect.TypeOf(ast.Name{})
+	tokenType = reflect.TypeOf(token.Token{})
+	docType   = reflect.TypeOf(phpdoc.Block{})
+	htmlType  = reflect.TypeOf(ast.InlineHTMLStmt{})
+)
+
+func (c *comparer) equal(path string, x, y reflect.Value) error {
+	if x.Kind() == reflect.Interface {
+		if x.IsNil() || y.IsNil() {
+			if x.IsNil() != y.IsNil() {
+				return fmt.Errorf("%s: %s != %s", path, describe(x), describe(y))
+			}
+			return nil
+		}
+		x, y = x.Elem(), y.Elem()
+	}
+	if x.Type() != y.Type() {
+		return fmt.Errorf("%s: %s != %s", path, describe(x), describe(y))
+	}
+	switch x.Kind() {
+	case reflect.Ptr:
+		if x.IsNil() || y.IsNil() {
+			if x.IsNil() != y.IsNil() {
+				return fmt.Errorf("%s: %s != %s", path, describe(x), describe(y))
+			}
+			return nil
+		}
+		return c.equal(path, x.Elem(), y.Elem())
+	case reflect.Struct:
+		return c.equalStruct(path, x, y)
+	case reflect.Slice:
+		if elems, ok := x.Interface().([]interface{}); ok {
+			// The elements of an UnknownExpr.
+			x, y = reflect.ValueOf(normalized(elems)), reflect.ValueOf(normalized(y.Interface().([]interface{})))
+		}
+		xs, ys := c.significant(0, x), c.significant(1, y)
+		if len(xs) != len(ys) {
+			return fmt.Errorf("%s: %d elements != %d", path, len(xs), len(ys))
+		}
+		for i := range xs {
+			if err := c.equal(fmt.Sprintf("%s[%d]", path, i), xs[i], ys[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.String:
+		if x.String() != y.String() {
+			return fmt.Errorf("%s: %q != %q", path, x.String(), y.String())
+		}
+		return nil
+	case reflect.Bool, reflect.Int, reflect.Uint:
+		if x.Interface() != y.Interface() {
+			return fmt.Errorf("%s: %v != %v", path, x.Interface(), y.Interface())
+		}
+		return nil
+	}
+	return fmt.Errorf("%s: cannot compare %s", path, x.Type())
+}
+
+func (c *comparer) equalStruct(path string, x, y reflect.Value) error {
+	switch x.Type() {
+	case tokenType:
+		a, b := x.Interface().(token.Token), y.Interface().(token.Token)
+		if a.Type != b.Type || a.Text != b.Text {
+			return fmt.Errorf("%s: %s %q != %s %q", path, a.Type, a.Text, b.Type, b.Text)
+		}
+		return nil
+	case nameType:
+		a, b := x.Addr().Interface().(*ast.Name), y.Addr().Interface().(*ast.Name)
+		if !equalNames(a, b) || a.Global != b.Global {
+			return fmt.Errorf("%s: %s != %s", path, describe(x), describe(y))
+		}
+		return nil
+	case htmlType:
+		// The line break right after ?> might change.
+		a, b := x.Interface().(ast.InlineHTMLStmt).Text, y.Interface().(ast.InlineHTMLStmt).Text
+		if lf(a) != lf(b) || trimNewline(a) != trimNewline(b) {
+			return fmt.Errorf("%s: %q != %q", path, a, b)
+		}
+		return nil
+	case docType:
+		a, b := docText(x.Addr().Interface().(*phpdoc.Block)), docText(y.Addr().Interface().(*phpdoc.Block))
+		if a != b {
+			return fmt.Errorf("%s: %q != %q", path, a, b)
+		}
+		return nil
+	}
+	t := x.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		fx, fy := x.Field(i), y.Field(i)
+		switch {
+		case t == fileType && (f.Name == "CRLF" || f.Name == "Comments" || f.Name == "Spans"):
+			continue
+		case f.Name == "OneLinePHP":
+			continue
+		case t == fileType && f.Name == "Namespace":
+			// Namespaces are always fully qualified.
+			a, b := fx.Interface().(*ast.Name), fy.Interface().(*ast.Name)
+			if (a == nil) != (b == nil) || a != nil && !equalNames(a, b) {
+				return fmt.Errorf("%s.%s: %s != %s", path, f.Name, describe(fx), describe(fy))
+			}
+			continue
+		case t == fileType && f.Name == "UseStmts":
+			// So are imports.
+			a, b := fx.Interface().([]*ast.UseStmt), fy.Interface().([]*ast.UseStmt)
+			if len(a) != len(b) {
+				return fmt.Errorf("%s.%s: %d elements != %d", path, f.Name, len(a), len(b))
+			}
+			for i := range a {
+				if !equalNames(a[i].Name, b[i].Name) || a[i].Alias != b[i].Alias {
+					return fmt.Errorf("%s.%s[%d]: %s != %s", path, f.Name, i,
+						describe(reflect.ValueOf(a[i].Name)), describe(reflect.ValueOf(b[i].Name)))
+				}
+			}
+			continue
+		case f.Name == "Comment" && f.Type.Kind() == reflect.String:
+			c.comment(0, fx.String())
+			c.comment(1, fy.String())
+			continue
+		}
+		if err := c.equal(path+"."+f.Name, fx, fy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// significant returns the elements of the slice v without blank
+// lines, whitespace, comments (which it collects as the comments of
+// the ith tree), and trailing commas.
+func (c *comparer) significant(i int, v reflect.Value) []reflect.Value {
+	var elems []reflect.Value
+	for j := 0; j < v.Len(); j++ {
+		e := v.Index(j)
+		switch n := e.Interface().(type) {
+		case *ast.BlankLine:
+			continue
+		case *ast.CommentStmt:
+			c.comment(i, n.Text)
+			continue
+		case token.Token:
+			switch n.Type {
+			case token.Whitespace:
+				continue
+			case token.Comment, token.DocComment:
+				c.comment(i, n.Text)
+				continue
+			}
+		}
+		elems = append(elems, e)
+	}
+	list := elems[:0]
+	for j, e := range elems {
+		if tok, ok := e.Interface().(token.Token); ok && tok.Type == token.Comma {
+			if j+1 == len(elems) || closes(elems[j+1].Interface()) {
+				continue
+			}
+		}
+		list = append(list, e)
+	}
+	return list
+}
+
+// closes reports whether elem closes a list.
+func closes(elem interface{}) bool {
+	switch e := elem.(type) {
+	case token.Token:
+		return e.Type == token.Rparen || e.Type == token.Rbrack
+	case string:
+		return e == ")"
+	}
+	return false
+}
+
+func (c *comparer) commentMap(i int, m ast.CommentMap) {
+	for _, cs := range m {
+		for _, g := range cs.Leading {
+			c.commentGroup(i, g)
+		}
+		c.commentGroup(i, cs.Trailing)
+	}
+}
+
+func (c *comparer) commentGroup(i int, g *ast.CommentGroup) {
+	if g == nil {
+		return
+	}
+	for _, com := range g.List {
+		c.comment(i, com.Text)
+	}
+}
+
+func (c *comparer) comment(i int, text string) {
+	if text == "" {
+		return
+	}
+	// The printer trims the blanks that end lines (e.g. the ones
+	// before ?> that ends a line comment). Line comments in CRLF
+	// files end with \r.
+	lines := strings.Split(lf(text), "\n")
+	for j, line := range lines {
+		lines[j] = strings.TrimRight(line, " \t\r")
+	}
+	c.comments[i] = append(c.comments[i], strings.Join(lines, "\n"))
+}
+
+// lf returns s with the line endings converted to \n, as the printer
+// might do outside of literals.
+func lf(s string) string {
+	return strings.Replace(s, "\r\n", "\n", -1)
+}
+
+// normalized returns a copy of elems with the text of the tokens
+// normalized the way the printer normalizes it.
+func normalized(elems []interface{}) []interface{} {
+	list := make([]interface{}, len(elems))
+	for i, e := range elems {
+		if tok, ok := e.(token.Token); ok {
+			tok.Text = ast.NormalizedText(elems, i)
+			e = tok
+		}
+		list[i] = e
+	}
+	return list
+}
+
+// equalNames reports whether the parts of a and b are equal. Names
+// are case-insensitive.
+func equalNames(a, b *ast.Name) bool {
+	if len(a.Parts) != len(b.Parts) {
+		return false
+	}
+	for i := range a.Parts {
+		if !strings.EqualFold(a.Parts[i], b.Parts[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func docText(doc *phpdoc.Block) string {
+	d := *doc
+	d.Indent = ""
+	buf := new(bytes.Buffer)
+	if err := phpdoc.Fprint(buf, &d); err != nil {
+		return err.Error()
+	}
+	return buf.String()
+}
+
+func describe(v reflect.Value) string {
+	if !v.IsValid() || (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+		return "nil"
+	}
+	if n, ok := v.Interface().(*ast.Name); ok {
+		v = reflect.ValueOf(*n)
+	}
+	if n, ok := v.Interface().(ast.Name); ok {
+		s := strings.Join(n.Parts, `\`)
+		if n.Global {
+			s = `\` + s
+		}
+		return s
+	}
+	return v.Type().String()
+}
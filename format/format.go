@@ -0,0 +1,151 @@
+// Package format implements standard formatting of PHP source. It's
+// the glue between parsing (see ast.Parse) and printing (see
+// ast.Config.Fprint) with a guarantee: the formatted source is parsed
+// again, and it must give an equivalent syntax tree. Otherwise, it's
+// a bug of the printer and nothing is written.
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"mibk.dev/php/ast"
+)
+
+// Source formats src in the style of c (ast.Mibk if nil) and returns
+// the result. src is expected to be a whole PHP file. If src has
+// a syntax error, the error is of type *ast.SyntaxError.
+func Source(src []byte, c *ast.Config) ([]byte, error) {
+	if c == nil {
+		c = &ast.Mibk
+	}
+	f, err := ast.Parse(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	return format(c, f)
+}
+
+// Range is like Source, but it formats only the statements,
+// declarations and members of src that overlap the bytes from start to
+// end (see ast.Config.FprintRange). The rest of src is left intact.
+func Range(src []byte, start, end int, c *ast.Config) ([]byte, error) {
+	if c == nil {
+		c = &ast.Mibk
+	}
+	f, err := ast.Parse(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	edits, err := c.FprintRange(src, start, end)
+	if err != nil {
+		return nil, err
+	}
+	var out []byte
+	off := 0
+	for _, e := range edits {
+		out = append(out, src[off:e.Start]...)
+		out = append(out, e.New...)
+		off = e.End
+	}
+	out = append(out, src[off:]...)
+	if err := check(f, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Node formats node in the Mibk style and writes the result to w. The
+// node might be a whole file (*ast.File) or a fragment of one: an
+// expression, a statement, a class member (*ast.ClassMemberDecl) or
+// a type (*ast.Type). Other nodes (e.g. parameters) are written
+// without the check.
+func Node(w io.Writer, node interface{}) error {
+	var out []byte
+	if f, ok := node.(*ast.File); ok {
+		var err error
+		if out, err = format(&ast.Mibk, f); err != nil {
+			return err
+		}
+	} else {
+		printed := node
+		if m, ok := node.(*ast.ClassMemberDecl); ok {
+			// Members are printed in lists only.
+			printed = []ast.Member{m}
+		}
+		buf := new(bytes.Buffer)
+		if err := ast.Fprint(buf, printed); err != nil {
+			return err
+		}
+		out = buf.Bytes()
+		if _, ok := node.(*ast.ClassMemberDecl); ok {
+			// Like the other fragments, they don't end with
+			// a newline.
+			out = bytes.TrimRight(out, "\r\n")
+		}
+		if err := checkFragment(node, string(out)); err != nil {
+			return err
+		}
+	}
+	_, err := w.Write(out)
+	return err
+}
+
+// checkFragment checks that src, the printed node, parses to
+// an equivalent node.
+func checkFragment(node interface{}, src string) error {
+	var got, want interface{} = nil, node
+	var err error
+	switch node.(type) {
+	case *ast.Type:
+		got, err = ast.ParseType(src)
+	case *ast.ClassMemberDecl:
+		got, err = ast.ParseMember(src)
+	case *ast.UnknownExpr:
+		got, err = ast.ParseExpr(src)
+	case *ast.FuncLit, *ast.MatchExpr, *ast.HeredocLit:
+		got, err = ast.ParseExpr(src)
+		want = &ast.UnknownExpr{Elems: []interface{}{node}}
+	case *ast.UnknownStmt, *ast.BlockStmt, *ast.IfStmt, *ast.SwitchStmt,
+		*ast.ForStmt, *ast.TryStmt, *ast.ConstDecl, *ast.FuncDecl,
+		*ast.ClassDecl, *ast.InterfaceDecl, *ast.TraitDecl, *ast.EnumDecl:
+		got, err = ast.ParseStmts(src)
+		want = []ast.Stmt{node}
+	default:
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("format: formatted source doesn't parse: %v", err)
+	}
+	if err := equivalent(want, got); err != nil {
+		return fmt.Errorf("format: formatted source isn't equivalent: %v", err)
+	}
+	return nil
+}
+
+// format prints f and checks that the output parses to an equivalent
+// file.
+func format(c *ast.Config, f *ast.File) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := c.Fprint(buf, f); err != nil {
+		return nil, err
+	}
+	if err := check(f, buf.Bytes()); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// check checks that out, the formatted f, parses to an equivalent
+// file.
+func check(f *ast.File, out []byte) error {
+	g, err := ast.Parse(bytes.NewReader(out))
+	if err != nil {
+		return fmt.Errorf("format: formatted source doesn't parse: %v", err)
+	}
+	if err := equivalent(f, g); err != nil {
+		return fmt.Errorf("format: formatted source isn't equivalent: %v", err)
+	}
+	return nil
+}
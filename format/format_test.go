@@ -0,0 +1,177 @@
+package format_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"mibk.dev/php/ast"
+	"mibk.dev/php/format"
+	"mibk.dev/php/token"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *ast.Config
+		src  string
+		want string
+	}{
+		{"default", nil, `<?php
+IF($a){echo 1;}ELSE IF($b) { // b
+FOO([1, 2]) ;
+}`, `<?php
+
+if ($a) {
+	echo 1;
+} elseif ($b) { // b
+	FOO([1, 2]);
+}`},
+		{"psr12", &ast.PSR12, `<?php
+namespace Foo;
+use Bar\Baz;
+function f(INT $x): ?BOOL { return (INTEGER) $x > 0X1F ? TRUE : null; }`, `<?php
+
+namespace Foo;
+
+use Bar\Baz;
+
+function f(int $x): ?bool
+{
+    return (int) $x > 0x1F ? true : null;
+}
+`},
+		{"wrapped", &ast.Config{LineWidth: 20}, `<?php
+foo($aaaa, $bbbb, $cccc);`, `<?php
+
+foo(
+	$aaaa,
+	$bbbb,
+	$cccc,
+);`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := format.Source([]byte(tt.src), tt.cfg)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSourceSyntaxError(t *testing.T) {
+	_, err := format.Source([]byte("<?php\nfoo(;"), nil)
+	if _, ok := err.(*ast.SyntaxError); !ok {
+		t.Errorf("got %v, want *ast.SyntaxError", err)
+	}
+}
+
+func TestRange(t *testing.T) {
+	src := []byte("<?php\nIF($a){foo(1) ;}\nbar(2) ;\n")
+	m := token.NewLineMap(src)
+	start := m.Offset(token.Pos{Line: 2, Column: 1})
+	got, err := format.Range(src, start, start, nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	want := "<?php\nif ($a) {\n\tfoo(1);\n}\nbar(2) ;\n"
+	if string(got) != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestNode(t *testing.T) {
+	f, err := ast.Parse(strings.NewReader("<?php\n$x = 1;"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := format.Node(buf, f); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if got, want := buf.String(), "<?php\n\n$x = 1;"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	expr, err := ast.ParseExpr("$a->b(1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmts, err := ast.ParseStmts("if($a){foo();}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := ast.ParseMember("PUBLIC function f() {}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	typ, err := ast.ParseType("?INT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fragments := []struct {
+		node interface{}
+		want string
+	}{
+		{expr, "$a->b(1)"},
+		{stmts[0], "if ($a) {\n\tfoo();\n}"},
+		{m, "public function f()\n{\n}"},
+		{typ, "?int"},
+	}
+	for _, tt := range fragments {
+		buf.Reset()
+		if err := format.Node(buf, tt.node); err != nil {
+			t.Errorf("%T: unexpected err: %v", tt.node, err)
+		} else if buf.String() != tt.want {
+			t.Errorf("%T: got %q, want %q", tt.node, buf, tt.want)
+		}
+	}
+
+	// The identifiers would be printed as one.
+	f = &ast.File{Stmts: []ast.Stmt{&ast.UnknownStmt{X: &ast.UnknownExpr{
+		Elems: []interface{}{
+			token.Token{Type: token.Ident, Text: "foo"},
+			token.Token{Type: token.Ident, Text: "bar"},
+		},
+	}}}}
+	buf.Reset()
+	if err := format.Node(buf, f); err == nil {
+		t.Errorf("want error, got output %q", buf)
+	} else if buf.Len() > 0 {
+		t.Errorf("got output %q despite error %v", buf, err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{"normalized", "<?php\nIF (TRUE) { $x = (INTEGER) 0X1; } ELSEIF (\\FALSE) {}"},
+		{"imports", "<?php\nnamespace \\A;\nuse \\B;\nclass C { use \\T; var $x; }"},
+		{"closure", "<?php\n$f = function () use () { return 1; };"},
+		{"template", "<p><?= $x; ?></p>\n"},
+		{"heredoc", "<?php\nif ($a) {\n    $s = <<<\"X\"\n      a\n    X;\n}"},
+		{"wrapped", "<?php\nfoo($aaaaaaaaaaaaaaaaaaaa, $bbbbbbbbbbbbbbbbbbbbbbb, $cccccccccccccccccccccccc, $dddddddddddddddddddddddd, $eeeeeeeeeeeeeeeeeeeeeeeee);"},
+		{"crlf", "<?php\r\n// c\r\n$a = 'x\r\ny'; // d\r\n"},
+		{"mixed literals", "<?php\r\n$a = <<<X\r\n  a\n  b\r\n  X;\r\n$b = \"c\nd\";\r\n?>\r\n<p>\n</p>\r\n"},
+		{"halt", "<?php $x = 1; __halt_compiler(); raw"},
+		{"halt tag", "<?php __HALT_COMPILER() ?>data"},
+		{"halt newline", "<?php __halt_compiler() ?>\ndata"},
+		{"echo tag", "<?= 1;"},
+		{"comment before tag", "<p><?php foo(); // c \t?></p>\n<?php\n/* a  \n b */\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, cfg := range []*ast.Config{nil, &ast.PSR12, {LineEnding: ast.LF, Align: true}} {
+				if err := format.Verify([]byte(tt.src), cfg); err != nil {
+					t.Errorf("unexpected err: %v", err)
+				}
+			}
+		})
+	}
+}
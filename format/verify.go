@@ -0,0 +1,212 @@
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"mibk.dev/php/ast"
+	"mibk.dev/php/internal/linediff"
+	"mibk.dev/php/token"
+)
+
+// Verify formats src like Source and checks the result more
+// thoroughly. Besides the syntax tree, the tokens of the output must
+// be those of src (whitespace and comments aside, and normalized like
+// the printer normalizes them), and formatting the output again must
+// not change it. Otherwise, the error describes the difference.
+func Verify(src []byte, c *ast.Config) error {
+	out, err := Source(src, c)
+	if err != nil {
+		return err
+	}
+	if err := equalTokens(src, out); err != nil {
+		return err
+	}
+	again, err := Source(out, c)
+	if err != nil {
+		return fmt.Errorf("format: formatting the output: %v", err)
+	}
+	if !bytes.Equal(out, again) {
+		return fmt.Errorf("format: formatting isn't idempotent (-once +twice)\n%s", linediff.Lines(out, again))
+	}
+	return nil
+}
+
+// equalTokens checks that the tokens of src and out are equal.
+func equalTokens(src, out []byte) error {
+	a, b := tokens(src), tokens(out)
+	textsA, textsB := normalize(a), normalize(b)
+	for i := 0; i < len(a) || i < len(b); i++ {
+		switch {
+		case i == len(a):
+			return fmt.Errorf("format: %v added at %d:%d of the output", b[i], b[i].Pos.Line, b[i].Pos.Column)
+		case i == len(b):
+			return fmt.Errorf("format: %v at %d:%d removed", a[i], a[i].Pos.Line, a[i].Pos.Column)
+		case a[i].Type != b[i].Type || textsA[i] != textsB[i]:
+			return fmt.Errorf("format: %v at %d:%d changed to %v", a[i], a[i].Pos.Line, a[i].Pos.Column, b[i])
+		}
+	}
+	return nil
+}
+
+// tokens returns the tokens of src without whitespace, comments, and
+// the tokens the printer might add or remove: trailing commas of lists,
+// semicolons before closing braces and tags and in echo tags (<?= …),
+// closing tags at the end, empty scopes of closures (use ()), and the
+// leading backslashes of namespaces and imports. The keyword var
+// becomes public, and __halt_compiler() is always followed by
+// a semicolon.
+func tokens(src []byte) []token.Token {
+	s := token.NewBytesScanner(src, token.WithMode(token.SkipWhitespace|token.SkipComments))
+	var list []token.Token
+	depth := 0
+	echo := false    // in an echo tag
+	haltTag := false // __halt_compiler() is followed by ?>
+	for {
+		tok := s.Next()
+		prev := token.Illegal
+		if n := len(list); n > 0 {
+			prev = list[n-1].Type
+		}
+		switch tok.Type {
+		case token.EOF:
+			if prev == token.CloseTag {
+				list = list[:len(list)-1]
+			}
+			return list
+		case token.EchoTag:
+			echo = true
+		case token.OpenTag:
+			echo = false
+		case token.Lbrace:
+			depth++
+		case token.Rbrace:
+			depth--
+			if prev == token.Semicolon {
+				list = list[:len(list)-1]
+			}
+		case token.CloseTag:
+			echo = false
+			if haltCompiler(list) {
+				// The printer might end it with ; instead.
+				tok.Type, tok.Text = token.Semicolon, ";"
+				haltTag = true
+				break
+			}
+			if prev == token.Semicolon {
+				list = list[:len(list)-1]
+			}
+		case token.Semicolon:
+			if echo {
+				continue
+			}
+		case token.InlineHTML:
+			if haltTag {
+				// The newline right after ?> isn't part of
+				// the data.
+				tok.Text = trimNewline(tok.Text)
+				haltTag = false
+			}
+		case token.Rparen, token.Rbrack:
+			if n := len(list); tok.Type == token.Rparen && n > 1 &&
+				list[n-2].Type == token.Use && prev == token.Lparen {
+				list = list[:n-2]
+				continue
+			}
+			if prev == token.Comma {
+				list = list[:len(list)-1]
+			}
+		case token.Backslash:
+			if prev == token.Namespace || prev == token.Use && depth == 0 {
+				continue
+			}
+		case token.VarKeyword:
+			tok.Type, tok.Text = token.Public, "public"
+		}
+		list = append(list, tok)
+	}
+}
+
+// haltCompiler reports whether list ends with __halt_compiler().
+func haltCompiler(list []token.Token) bool {
+	n := len(list)
+	return n > 2 && list[n-3].Type == token.HaltCompiler &&
+		list[n-2].Type == token.Lparen && list[n-1].Type == token.Rparen
+}
+
+// normalize returns the texts of the tokens of list normalized the
+// way the printer normalizes them. The texts of literals and inline
+// HTML are kept byte for byte, line endings included; only the line
+// break right after ?> might change.
+func normalize(list []token.Token) []string {
+	elems := make([]interface{}, len(list))
+	for i, tok := range list {
+		elems[i] = tok
+	}
+	texts := make([]string, len(list))
+	for i, tok := range list {
+		switch {
+		case tok.Type == token.OpenTag, tok.Type == token.CloseTag:
+			texts[i] = strings.TrimSpace(tok.Text)
+		case tok.Type == token.String && strings.HasPrefix(tok.Text, "<<<"):
+			texts[i] = heredocText(tok.Text)
+		case tok.Type == token.InlineHTML && i > 0 && list[i-1].Type == token.CloseTag:
+			texts[i] = tok.Text
+			if s := trimNewline(tok.Text); s != tok.Text {
+				texts[i] = "\n" + s
+			}
+		case tok.Type == token.Ident && !isMember(list, i):
+			// The types of functions and properties are
+			// normalized as types, not as expressions.
+			if s, ok := ast.BuiltinType(tok.Text); ok {
+				texts[i] = s
+				break
+			}
+			fallthrough
+		default:
+			texts[i] = ast.NormalizedText(elems, i)
+		}
+	}
+	return texts
+}
+
+// isMember reports whether list[i] is the name of a member (e.g.
+// A::INT) or a part of a qualified name.
+func isMember(list []token.Token, i int) bool {
+	if i > 0 {
+		switch list[i-1].Type {
+		case token.Arrow, token.QmarkArrow, token.DoubleColon, token.Backslash:
+			return true
+		}
+	}
+	return i+1 < len(list) && list[i+1].Type == token.Backslash
+}
+
+// heredocText returns the text of a heredoc without the indentation
+// of its closing identifier and the optional quotes around the opening
+// one, which the printer might change. So might it change the line
+// endings of the opening and the closing line, which aren't part of
+// the literal.
+func heredocText(s string) string {
+	i, j := strings.IndexByte(s, '\n'), strings.LastIndexByte(s, '\n')
+	opening, closing := s[:i], s[j+1:]
+	indent := closing[:len(closing)-len(strings.TrimLeft(closing, " \t"))]
+	lines := []string{"<<<" + strings.Trim(strings.TrimSpace(opening[len("<<<"):]), `"`) + "\n"}
+	if i < j {
+		body := strings.TrimSuffix(s[i+1:j], "\r")
+		for _, line := range strings.SplitAfter(body, "\n") {
+			lines = append(lines, strings.TrimPrefix(line, indent))
+		}
+		lines = append(lines, "\n")
+	}
+	return strings.Join(lines, "") + strings.TrimPrefix(closing, indent)
+}
+
+// trimNewline returns s without the line break it starts with.
+func trimNewline(s string) string {
+	if strings.HasPrefix(s, "\r\n") {
+		return s[2:]
+	}
+	return strings.TrimPrefix(s, "\n")
+}
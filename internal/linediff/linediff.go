@@ -0,0 +1,47 @@
+// Package linediff compares texts line by line.
+package linediff
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/mibk/diff"
+)
+
+// Lines returns the lines of a and b as a diff: the lines only in a
+// are prefixed with -, the ones only in b with +, and the common ones
+// with a space. If a and b are equal, the diff is empty.
+func Lines(a, b []byte) string {
+	linesA := bytes.Split(a, []byte("\n"))
+	linesB := bytes.Split(b, []byte("\n"))
+	eds := diff.Diff(slices{linesA, linesB})
+	if len(eds) == 0 {
+		return ""
+	}
+
+	eds = append(eds, diff.Edit{Index: len(linesA), Op: diff.None})
+	var i int
+	var buf strings.Builder
+	for _, ed := range eds {
+		for ; i < ed.Index; i++ {
+			fmt.Fprintf(&buf, " %s\n", linesA[i])
+		}
+		if ed.Op == diff.Delete {
+			fmt.Fprintf(&buf, "-%s\n", linesA[i])
+			i++
+		} else if ed.Op == diff.Insert {
+			fmt.Fprintf(&buf, "+%s\n", linesB[ed.Bindex])
+		}
+	}
+	return buf.String()
+}
+
+type slices struct {
+	a, b [][]byte
+}
+
+func (d slices) Lens() (n, m int) { return len(d.a), len(d.b) }
+func (d slices) Equal(i, j int) bool {
+	return bytes.Equal(d.a[i], d.b[j])
+}
@@ -0,0 +1,124 @@
+package token
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// A LineMap converts between positions, byte offsets and UTF-16
+// columns in a source. Like the Scanner, it counts columns in runes
+// (each byte of invalid UTF-8 is a rune), while e.g. the Language
+// Server Protocol counts them in UTF-16 code units. A leading byte
+// order mark doesn't take up a column.
+type LineMap struct {
+	src   string
+	lines []int // offsets of the line starts
+}
+
+// NewLineMap returns a LineMap for src.
+func NewLineMap(src []byte) *LineMap {
+	m := &LineMap{src: string(src), lines: []int{0}}
+	if strings.HasPrefix(m.src, bom) {
+		m.lines[0] = len(bom)
+	}
+	for i := 0; i < len(m.src); i++ {
+		if m.src[i] == '\n' {
+			m.lines = append(m.lines, i+1)
+		}
+	}
+	return m
+}
+
+// line returns the text of the nth line (1-based) including the
+// newline, along with the offset of its start. n is clamped to the
+// valid range.
+func (m *LineMap) line(n int) (string, int) {
+	n = clamp(n, 1, len(m.lines))
+	start, end := m.lines[n-1], len(m.src)
+	if n < len(m.lines) {
+		end = m.lines[n]
+	}
+	return m.src[start:end], start
+}
+
+// Offset returns the byte offset of pos. Positions past the end of a
+// line are clamped to its end.
+func (m *LineMap) Offset(pos Pos) int {
+	line, start := m.line(pos.Line)
+	col := 1
+	for i := range line {
+		if col == pos.Column {
+			return start + i
+		}
+		col++
+	}
+	return start + len(line)
+}
+
+// Pos returns the position of the byte offset off. An offset in the
+// middle of a rune is the position of the rune.
+func (m *LineMap) Pos(off int) Pos {
+	off = clamp(off, 0, len(m.src))
+	n := sort.Search(len(m.lines), func(i int) bool { return m.lines[i] > off })
+	line, start := m.line(n)
+	pos := Pos{Line: clamp(n, 1, len(m.lines)), Column: 1}
+	for i, w := 0, 0; i < len(line); i += w {
+		_, w = utf8.DecodeRuneInString(line[i:])
+		if start+i+w > off {
+			break
+		}
+		pos.Column++
+	}
+	return pos
+}
+
+// ByteColumn returns the column of pos in bytes (1-based).
+func (m *LineMap) ByteColumn(pos Pos) int {
+	_, start := m.line(pos.Line)
+	return m.Offset(pos) - start + 1
+}
+
+// UTF16Column returns the column of pos in UTF-16 code units
+// (1-based). LSP characters are 0-based, i.e. UTF16Column(pos)-1.
+func (m *LineMap) UTF16Column(pos Pos) int {
+	line, start := m.line(pos.Line)
+	col := 1
+	for _, r := range line[:m.Offset(pos)-start] {
+		col += utf16Len(r)
+	}
+	return col
+}
+
+// PosFromUTF16 returns the position of the column col, counted in
+// UTF-16 code units (1-based), on the given line. A column in the
+// middle of a surrogate pair is the position of the pair.
+func (m *LineMap) PosFromUTF16(line, col int) Pos {
+	text, _ := m.line(line)
+	pos := Pos{Line: clamp(line, 1, len(m.lines)), Column: 1}
+	n := 1
+	for _, r := range text {
+		if n += utf16Len(r); n > col {
+			break
+		}
+		pos.Column++
+	}
+	return pos
+}
+
+func utf16Len(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+func clamp(x, lo, hi int) int {
+	if x < lo {
+		return lo
+	}
+	if x > hi {
+		return hi
+	}
+	return x
+}
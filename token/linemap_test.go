@@ -0,0 +1,59 @@
+package token_test
+
+import (
+	"testing"
+
+	"mibk.dev/php/token"
+)
+
+func TestLineMap(t *testing.T) {
+	const src = "\uFEFF<?php\n$∂ = '😀' . $x;\n\xff$y"
+	m := token.NewLineMap([]byte(src))
+	tests := []struct {
+		pos    token.Pos
+		offset int
+		byteCol,
+		utf16Col int
+	}{
+		{pos("1:1"), 3, 1, 1},
+		{pos("1:6"), 8, 6, 6},
+		{pos("2:1"), 9, 1, 1},
+		{pos("2:3"), 13, 5, 3},  // after ∂
+		{pos("2:6"), 16, 8, 6},  // '
+		{pos("2:7"), 17, 9, 7},  // 😀
+		{pos("2:8"), 21, 13, 9}, // '
+		{pos("2:15"), 28, 20, 16},
+		{pos("3:2"), 30, 2, 2}, // after invalid UTF-8
+		{pos("3:4"), 32, 4, 4}, // EOF
+	}
+	for _, tt := range tests {
+		if got := m.Offset(tt.pos); got != tt.offset {
+			t.Errorf("Offset(%v) = %d, want %d", tt.pos, got, tt.offset)
+		}
+		if got := m.Pos(tt.offset); got != tt.pos {
+			t.Errorf("Pos(%d) = %v, want %v", tt.offset, got, tt.pos)
+		}
+		if got := m.ByteColumn(tt.pos); got != tt.byteCol {
+			t.Errorf("ByteColumn(%v) = %d, want %d", tt.pos, got, tt.byteCol)
+		}
+		if got := m.UTF16Column(tt.pos); got != tt.utf16Col {
+			t.Errorf("UTF16Column(%v) = %d, want %d", tt.pos, got, tt.utf16Col)
+		}
+		if got := m.PosFromUTF16(tt.pos.Line, tt.utf16Col); got != tt.pos {
+			t.Errorf("PosFromUTF16(%d, %d) = %v, want %v", tt.pos.Line, tt.utf16Col, got, tt.pos)
+		}
+	}
+
+	// Offsets within a rune (or the BOM) are the positions of the rune.
+	for off, want := range map[int]token.Pos{0: pos("1:1"), 1: pos("1:1"), 11: pos("2:2"), 19: pos("2:7")} {
+		if got := m.Pos(off); got != want {
+			t.Errorf("Pos(%d) = %v, want %v", off, got, want)
+		}
+	}
+	if got := m.PosFromUTF16(2, 8); got != pos("2:7") {
+		t.Errorf("PosFromUTF16 within a surrogate pair = %v, want 2:7", got)
+	}
+	if got := m.Offset(pos("1:99")); got != 9 {
+		t.Errorf("Offset past the line end = %d, want 9", got)
+	}
+}
@@ -0,0 +1,238 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Unquote interprets tok, a String token, as a single-quoted,
+// double-quoted, heredoc or nowdoc PHP string literal, and returns the
+// string value that it represents. Strings that interpolate variables
+// have no constant value, and Unquote returns an error for them.
+func Unquote(tok Token) (string, error) {
+	if tok.Type != String {
+		return "", fmt.Errorf("cannot unquote %v", tok)
+	}
+	s := tok.Text
+	switch {
+	case len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'':
+		return unquoteSingle(s[1 : len(s)-1]), nil
+	case len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"':
+		return unescape(s[1:len(s)-1], '"')
+	case strings.HasPrefix(s, "<<<"):
+		return unquoteHereDoc(s)
+	}
+	return "", fmt.Errorf("invalid string literal %s", s)
+}
+
+func unquoteSingle(s string) string {
+	if !strings.ContainsRune(s, '\\') {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\\' && i+1 < len(s) && (s[i+1] == '\\' || s[i+1] == '\'') {
+			i++
+			c = s[i]
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+func unquoteHereDoc(s string) (string, error) {
+	// The opening line: <<< [ ws ] ( ident | "ident" | 'ident' ) [ ws ] newline
+	i := strings.IndexByte(s, '\n')
+	if i < 0 {
+		return "", fmt.Errorf("invalid heredoc literal %s", s)
+	}
+	opening := strings.TrimSpace(s[len("<<<"):i])
+	nowdoc := strings.HasPrefix(opening, "'")
+	label := strings.Trim(opening, `'"`)
+
+	// The closing line: [ indentation ] ident
+	body := s[i+1:]
+	j := strings.LastIndexByte(body, '\n')
+	var indent string
+	if j < 0 {
+		// Empty body.
+		indent = strings.TrimSuffix(body, label)
+		body = ""
+	} else {
+		indent = strings.TrimSuffix(body[j+1:], label)
+		body = strings.TrimSuffix(body[:j], "\r")
+	}
+	if strings.Trim(indent, " \t") != "" {
+		return "", fmt.Errorf("invalid heredoc literal %s", s)
+	}
+
+	body, err := stripIndent(body, len(indent))
+	if err != nil {
+		return "", err
+	}
+	if nowdoc {
+		return body, nil
+	}
+	return unescape(body, 0)
+}
+
+// stripIndent removes n bytes of indentation from every line of s. It
+// reports an error if a line that is not empty is indented less.
+func stripIndent(s string, n int) (string, error) {
+	if n == 0 {
+		return s, nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	for i, line := range lines {
+		ws := len(line) - len(strings.TrimLeft(line, " \t"))
+		switch {
+		case ws >= n:
+			lines[i] = line[n:]
+		case strings.TrimRight(line, "\r\n") == line[:ws]:
+			// Whitespace-only lines might be indented less.
+			lines[i] = line[ws:]
+		default:
+			return "", fmt.Errorf("invalid body indentation level on line %d (expecting an indentation level of at least %d)", i+1, n)
+		}
+	}
+	return strings.Join(lines, ""), nil
+}
+
+// unescape interprets escape sequences in the body of a double-quoted
+// (quote is '"') or heredoc (quote is 0) string.
+func unescape(s string, quote byte) (string, error) {
+	if !strings.ContainsAny(s, `\$`) {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '$' {
+			if i+1 < len(s) && isIdentStart(s[i+1]) {
+				return "", errors.New("cannot unquote string with variable interpolation")
+			}
+		} else if c == '{' && i+1 < len(s) && s[i+1] == '$' {
+			return "", errors.New("cannot unquote string with variable interpolation")
+		}
+		if c != '\\' || i+1 == len(s) {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		switch c = s[i]; c {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case 'v':
+			b.WriteByte('\v')
+		case 'e':
+			b.WriteByte(0x1b)
+		case 'f':
+			b.WriteByte('\f')
+		case '\\', '$':
+			b.WriteByte(c)
+		case '"', '`':
+			if c != quote {
+				b.WriteByte('\\')
+			}
+			b.WriteByte(c)
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			j := i + 1
+			for j < len(s) && j < i+3 && isOctal(rune(s[j])) {
+				j++
+			}
+			n, _ := strconv.ParseUint(s[i:j], 8, 16)
+			// Octal escapes overflowing a byte are silently truncated.
+			b.WriteByte(byte(n))
+			i = j - 1
+		case 'x':
+			j := i + 1
+			for j < len(s) && j < i+3 && isHex(rune(s[j])) {
+				j++
+			}
+			if j == i+1 {
+				b.WriteString(`\x`)
+				break
+			}
+			n, _ := strconv.ParseUint(s[i+1:j], 16, 8)
+			b.WriteByte(byte(n))
+			i = j - 1
+		case 'u':
+			if i+1 == len(s) || s[i+1] != '{' {
+				b.WriteString(`\u`)
+				break
+			}
+			j := strings.IndexByte(s[i:], '}')
+			if j < 0 {
+				return "", errors.New("invalid UTF-8 codepoint escape sequence")
+			}
+			j += i
+			n, err := strconv.ParseUint(s[i+2:j], 16, 32)
+			if err != nil || n > utf8.MaxRune {
+				return "", errors.New("invalid UTF-8 codepoint escape sequence")
+			}
+			// Unlike utf8.AppendRune, PHP encodes surrogate
+			// halves as they are.
+			b.WriteString(encodeRune(rune(n)))
+			i = j
+		default:
+			// Unknown escape sequences are kept as they are.
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), nil
+}
+
+func encodeRune(r rune) string {
+	if 0xD800 <= r && r <= 0xDFFF {
+		return string([]byte{
+			0xE0 | byte(r>>12),
+			0x80 | byte(r>>6)&0x3F,
+			0x80 | byte(r)&0x3F,
+		})
+	}
+	return string(r)
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c >= utf8.RuneSelf
+}
+
+// ParseInt returns the value of tok, an Int token, which might be a
+// decimal, hexadecimal (0x), binary (0b), octal (0o or a leading 0)
+// literal with optional underscore separators. If the value overflows
+// int64 (PHP would evaluate such a literal as a float), the returned
+// error is a *strconv.NumError with Err set to strconv.ErrRange.
+func ParseInt(tok Token) (int64, error) {
+	if tok.Type != Int {
+		return 0, fmt.Errorf("cannot parse %v as int", tok)
+	}
+	// The syntax of PHP integer literals matches the Go syntax.
+	return strconv.ParseInt(tok.Text, 0, 64)
+}
+
+// ParseFloat returns the value of tok, which must be either a Float
+// token, or an Int token, in which case it is converted to a float.
+func ParseFloat(tok Token) (float64, error) {
+	switch tok.Type {
+	case Float:
+		return strconv.ParseFloat(strings.ReplaceAll(tok.Text, "_", ""), 64)
+	case Int:
+		n, ok := new(big.Int).SetString(tok.Text, 0)
+		if !ok {
+			return 0, fmt.Errorf("invalid int literal %s", tok.Text)
+		}
+		f, _ := new(big.Float).SetInt(n).Float64()
+		return f, nil
+	}
+	return 0, fmt.Errorf("cannot parse %v as float", tok)
+}
@@ -0,0 +1,133 @@
+package token_test
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"mibk.dev/php/token"
+)
+
+func TestUnquote(t *testing.T) {
+	tests := []struct {
+		lit  string
+		want string
+	}{
+		{`''`, ""},
+		{`'a\'b\\c\d\n'`, `a'b\c\d\n`},
+		{`""`, ""},
+		{`"\"\\\$"`, `"\$`},
+		{`"\n\r\t\v\e\f"`, "\n\r\t\v\x1b\f"},
+		{`"\101\0\7a\400"`, "A\x00\x07a\x00"},
+		{`"\x41\x4g\xg"`, "A\x04g\\xg"},
+		{`"\u{1F600}\u{41}A"`, "😀AA"},
+		{`"\u0041"`, `\u0041`},
+		{`"\%\'\` + "`" + `"`, `\%\'\` + "`"},
+		{`"$ { $ price: 5$"`, "$ { $ price: 5$"},
+		{"<<<END\nEND", ""},
+		{"<<<END\na\\tb \"c\" \\\"\nEND", "a\tb \"c\" \\\""},
+		{"<<< \"END\" \nline\n\nEND", "line\n"},
+		{"<<<'END'\na\\tb \\\\ $x\nEND", "a\\tb \\\\ $x"},
+		{"<<<END\r\nwin\r\nEND", "win"},
+		{"<<<END\n    a\n      b\n\n  \n    END", "a\n  b\n\n"},
+		{"<<<'END'\n\t\tx\n\t\tEND", "x"},
+	}
+
+	for _, tt := range tests {
+		got, err := token.Unquote(token.Token{Type: token.String, Text: tt.lit})
+		if err != nil {
+			t.Errorf("Unquote(%q): unexpected err: %v", tt.lit, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Unquote(%q) = %q, want %q", tt.lit, got, tt.want)
+		}
+	}
+}
+
+func TestUnquoteErrors(t *testing.T) {
+	tests := []struct {
+		tok     token.Token
+		wantErr string
+	}{
+		{token.Token{Type: token.Int, Text: "1"}, `cannot unquote Int("1")`},
+		{token.Token{Type: token.String, Text: "'abc"}, "invalid string literal 'abc"},
+		{token.Token{Type: token.String, Text: `"a $b"`}, "cannot unquote string with variable interpolation"},
+		{token.Token{Type: token.String, Text: `"a {$b}"`}, "cannot unquote string with variable interpolation"},
+		{token.Token{Type: token.String, Text: "<<<X\n$x\nX"}, "cannot unquote string with variable interpolation"},
+		{token.Token{Type: token.String, Text: `"\u{110000}"`}, "invalid UTF-8 codepoint escape sequence"},
+		{token.Token{Type: token.String, Text: `"\u{12"`}, "invalid UTF-8 codepoint escape sequence"},
+		{token.Token{Type: token.String, Text: "<<<X\n  a\n b\n  X"}, "invalid body indentation level on line 2 (expecting an indentation level of at least 2)"},
+	}
+
+	for _, tt := range tests {
+		errStr := "<nil>"
+		if _, err := token.Unquote(tt.tok); err != nil {
+			errStr = err.Error()
+		}
+		if errStr != tt.wantErr {
+			t.Errorf("Unquote(%v):\n got %s\nwant %s", tt.tok, errStr, tt.wantErr)
+		}
+	}
+}
+
+func TestParseInt(t *testing.T) {
+	tests := []struct {
+		lit  string
+		want int64
+	}{
+		{"0", 0},
+		{"42", 42},
+		{"1_000_000", 1000000},
+		{"0x1A", 26},
+		{"0XfF_fF", 65535},
+		{"0b101", 5},
+		{"0B1_0", 2},
+		{"017", 15},
+		{"0o17", 15},
+		{"0O1_7", 15},
+		{"9223372036854775807", 9223372036854775807},
+	}
+
+	for _, tt := range tests {
+		got, err := token.ParseInt(token.Token{Type: token.Int, Text: tt.lit})
+		if err != nil {
+			t.Errorf("ParseInt(%s): unexpected err: %v", tt.lit, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseInt(%s) = %d, want %d", tt.lit, got, tt.want)
+		}
+	}
+
+	_, err := token.ParseInt(token.Token{Type: token.Int, Text: "9223372036854775808"})
+	if !errors.Is(err, strconv.ErrRange) {
+		t.Errorf("ParseInt: got err %v, want %v", err, strconv.ErrRange)
+	}
+}
+
+func TestParseFloat(t *testing.T) {
+	tests := []struct {
+		tok  token.Token
+		want float64
+	}{
+		{token.Token{Type: token.Float, Text: "3.14"}, 3.14},
+		{token.Token{Type: token.Float, Text: ".5"}, 0.5},
+		{token.Token{Type: token.Float, Text: "1e-3"}, 0.001},
+		{token.Token{Type: token.Float, Text: "1_000.000_5"}, 1000.0005},
+		{token.Token{Type: token.Float, Text: "2E+2"}, 200},
+		{token.Token{Type: token.Int, Text: "0x10"}, 16},
+		{token.Token{Type: token.Int, Text: "0xFFFFFFFFFFFFFFFF"}, 18446744073709551615},
+	}
+
+	for _, tt := range tests {
+		got, err := token.ParseFloat(tt.tok)
+		if err != nil {
+			t.Errorf("ParseFloat(%s): unexpected err: %v", tt.tok.Text, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseFloat(%s) = %v, want %v", tt.tok.Text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package token
+
+// A Mode controls which tokens a Scanner returns.
+type Mode uint
+
+const (
+	ScanComments    Mode = 1 << iota // return comments as Comment tokens
+	ScanDocComments                  // return doc comments as DocComment tokens, not as comments
+	SkipWhitespace                   // don't return whitespace (see Scanner.Space)
+	SkipComments                     // collect comments instead of returning them (see Scanner.Comments)
+)
+
+// DefaultMode makes a Scanner return all tokens, i.e. the whole source
+// can be reconstructed from them. Scanners use it unless told otherwise.
+const DefaultMode = ScanComments | ScanDocComments
+
+// WithMode makes the Scanner scan in mode m.
+func WithMode(m Mode) Option {
+	return func(s *Scanner) { s.mode = m }
+}
+
+// Mode returns the mode s scans in.
+func (s *Scanner) Mode() Mode { return s.mode }
+
+// Space returns the whitespace right before the last token returned by
+// Next, if the whitespace was skipped. Otherwise, the returned token has
+// empty text.
+func (s *Scanner) Space() Token { return s.space }
+
+// Comments returns the comments collected so far in the SkipComments
+// mode, in the order they appear in the source.
+func (s *Scanner) Comments() []Token { return s.comments }
+
+// skip reports whether the token tok should not be returned in the
+// current mode. It might change the type of tok (e.g. make a doc
+// comment an ordinary comment).
+func (s *Scanner) skip(tok *Token) bool {
+	switch tok.Type {
+	case Whitespace:
+		if s.mode&SkipWhitespace == 0 {
+			return false
+		}
+		s.space = *tok
+		return true
+	case DocComment:
+		if s.mode&ScanDocComments == 0 {
+			tok.Type = Comment
+		}
+	case Comment:
+	default:
+		return false
+	}
+	if tok.Type == Comment && s.mode&ScanComments == 0 {
+		s.space = Token{}
+		return true
+	}
+	if s.mode&SkipComments != 0 {
+		s.comments = append(s.comments, *tok)
+		s.space = Token{}
+		return true
+	}
+	return false
+}
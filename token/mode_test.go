@@ -0,0 +1,90 @@
+package token_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"mibk.dev/php/token"
+)
+
+func TestMode(t *testing.T) {
+	const input = "<?php /** doc */\n$a # one\n= /* two */ 1;"
+	tests := []struct {
+		name     string
+		mode     token.Mode
+		want     []string
+		comments []string
+	}{{
+		"default",
+		token.DefaultMode,
+		[]string{"<?php", " ", "/** doc */", "\n", "$a", " ", "# one", "\n", "=", " ", "/* two */", " ", "1", ";"},
+		nil,
+	}, {
+		"skip whitespace",
+		token.DefaultMode | token.SkipWhitespace,
+		[]string{"<?php", "/** doc */", "$a", "# one", "=", "/* two */", "1", ";"},
+		nil,
+	}, {
+		"doc comments only",
+		token.ScanDocComments | token.SkipWhitespace,
+		[]string{"<?php", "/** doc */", "$a", "=", "1", ";"},
+		nil,
+	}, {
+		"no comments",
+		0,
+		[]string{"<?php", " ", "\n", "$a", " ", "\n", "=", " ", " ", "1", ";"},
+		nil,
+	}, {
+		"collect comments",
+		token.ScanComments | token.SkipWhitespace | token.SkipComments,
+		[]string{"<?php", "$a", "=", "1", ";"},
+		[]string{"Comment(\"/** doc */\")", "Comment(\"# one\")", "Comment(\"/* two */\")"},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := token.NewScanner(strings.NewReader(input), token.WithMode(tt.mode))
+			if sc.Mode() != tt.mode {
+				t.Fatalf("got mode %v, want %v", sc.Mode(), tt.mode)
+			}
+			var got []string
+			for tok := sc.Next(); tok.Type != token.EOF; tok = sc.Next() {
+				got = append(got, tok.Text)
+			}
+			if err := sc.Err(); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("tokens don't match: (-got +want)\n%s", diff)
+			}
+			var comments []string
+			for _, c := range sc.Comments() {
+				comments = append(comments, c.String())
+			}
+			if diff := cmp.Diff(comments, tt.comments); diff != "" {
+				t.Errorf("comments don't match: (-got +want)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSpace(t *testing.T) {
+	sc := token.NewScanner(strings.NewReader("<?php $a  =\n\t1 /* c */;"), token.WithMode(token.SkipWhitespace))
+	var got []string
+	for tok := sc.Next(); tok.Type != token.EOF; tok = sc.Next() {
+		sp := sc.Space()
+		got = append(got, sp.Pos.String()+" "+sp.Text+"|"+tok.Text)
+	}
+	want := []string{
+		"0:0 |<?php",
+		"1:6  |$a",
+		"1:9   |=",
+		"1:12 \n\t|1",
+		"0:0 |;", // The comment is skipped.
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("spaces don't match: (-got +want)\n%s", diff)
+	}
+}
@@ -0,0 +1,132 @@
+package token
+
+import "strings"
+
+// Operator precedences, as defined by the PHP operator table, from
+// the lowest to the highest. Non-operators have the precedence
+// LowestPrec.
+const (
+	LowestPrec = iota
+	precOr     // or
+	precXor    // xor
+	precAnd    // and
+	precPrint  // print
+	precYield  // yield
+	precAssign // = += -= …
+	precTernary
+	precCoalesce
+	precLor
+	precLand
+	precBitOr
+	precBitXor
+	precBitAnd
+	precEquality   // == != === !== <=>
+	precComparison // < <= > >=
+	precConcat
+	precShift
+	precAdd
+	precMul
+	precNot
+	precInstanceof
+	precUnary // ++ -- ~ @ (int) …
+	precPow
+	precNew // clone new
+
+	HighestPrec = precNew
+)
+
+// Precedence returns the precedence of the operator t. Operators that
+// are both binary and unary (+ and -) have the precedence of the binary
+// operator. Note that the logical operators "and" and "or" are scanned
+// as Land and Lor, though they bind less tightly than && and ||; use
+// Token.Precedence to tell them apart.
+func (t Type) Precedence() int {
+	switch t {
+	case Lxor:
+		return precXor
+	case Print:
+		return precPrint
+	case Yield:
+		return precYield
+	case Qmark:
+		return precTernary
+	case Coalesce:
+		return precCoalesce
+	case Lor:
+		return precLor
+	case Land:
+		return precLand
+	case Or:
+		return precBitOr
+	case Xor:
+		return precBitXor
+	case And:
+		return precBitAnd
+	case Eq, Neq, Identical, Nidentical, Spaceship:
+		return precEquality
+	case Lt, Gt, Leq, Geq:
+		return precComparison
+	case Concat:
+		return precConcat
+	case Shl, Shr:
+		return precShift
+	case Add, Sub:
+		return precAdd
+	case Mul, Quo, Rem:
+		return precMul
+	case Not:
+		return precNot
+	case Instanceof:
+		return precInstanceof
+	case Inc, Dec, Tilde, At:
+		return precUnary
+	case Pow:
+		return precPow
+	case Clone, New:
+		return precNew
+	}
+	switch {
+	case t.IsAssignOp():
+		return precAssign
+	case t.IsCast():
+		return precUnary
+	}
+	return LowestPrec
+}
+
+// Precedence is like Type.Precedence, but it tells the logical
+// operators "and" and "or" from && and ||.
+func (t Token) Precedence() int {
+	switch {
+	case t.Type == Land && strings.EqualFold(t.Text, "and"):
+		return precAnd
+	case t.Type == Lor && strings.EqualFold(t.Text, "or"):
+		return precOr
+	}
+	return t.Type.Precedence()
+}
+
+// IsOperator reports whether t is an operator, i.e. whether it has
+// a precedence.
+func (t Type) IsOperator() bool { return t.Precedence() != LowestPrec }
+
+// An Assoc is the associativity of an operator.
+type Assoc int
+
+const (
+	NonAssoc   Assoc = iota // non-associative, or not applicable (e.g. unary operators)
+	LeftAssoc               // a op b op c = (a op b) op c
+	RightAssoc              // a op b op c = a op (b op c)
+)
+
+// Associativity returns the associativity of the operator t.
+func (t Type) Associativity() Assoc {
+	switch t.Precedence() {
+	case precOr, precXor, precAnd, precLor, precLand, precBitOr, precBitXor, precBitAnd,
+		precConcat, precShift, precAdd, precMul, precInstanceof:
+		return LeftAssoc
+	case precAssign, precCoalesce, precPow:
+		return RightAssoc
+	}
+	return NonAssoc
+}
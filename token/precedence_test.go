@@ -0,0 +1,72 @@
+package token_test
+
+import (
+	"testing"
+
+	"mibk.dev/php/token"
+)
+
+func TestPrecedence(t *testing.T) {
+	// Each operator binds more tightly than the previous one.
+	ops := []token.Type{
+		token.Lxor, token.Print, token.Yield, token.Assign, token.Qmark,
+		token.Coalesce, token.Lor, token.Land, token.Or, token.Xor,
+		token.And, token.Identical, token.Leq, token.Concat, token.Shl,
+		token.Sub, token.Rem, token.Not, token.Instanceof, token.IntCast,
+		token.Pow, token.New,
+	}
+	prev := token.LowestPrec
+	for _, op := range ops {
+		prec := op.Precedence()
+		if prec <= prev {
+			t.Errorf("%v: got precedence %d, want more than %d", op, prec, prev)
+		}
+		if !op.IsOperator() {
+			t.Errorf("%v is not an operator", op)
+		}
+		prev = prec
+	}
+	if prev != token.HighestPrec {
+		t.Errorf("got highest precedence %d, want %d", prev, token.HighestPrec)
+	}
+
+	for _, typ := range []token.Type{token.Ident, token.Comma, token.Semicolon, token.Arrow, token.Function} {
+		if typ.IsOperator() {
+			t.Errorf("%v is an operator", typ)
+		}
+	}
+
+	and := token.Token{Type: token.Land, Text: "AND"}
+	or := token.Token{Type: token.Lor, Text: "or"}
+	xor := token.Token{Type: token.Lxor, Text: "xor"}
+	if !(or.Precedence() < xor.Precedence() && xor.Precedence() < and.Precedence() && and.Precedence() < token.Assign.Precedence()) {
+		t.Errorf("got precedences or=%d xor=%d and=%d, want increasing", or.Precedence(), xor.Precedence(), and.Precedence())
+	}
+	if p := (token.Token{Type: token.Land, Text: "&&"}).Precedence(); p != token.Land.Precedence() {
+		t.Errorf("got && precedence %d, want %d", p, token.Land.Precedence())
+	}
+}
+
+func TestAssociativity(t *testing.T) {
+	tests := []struct {
+		typ  token.Type
+		want token.Assoc
+	}{
+		{token.Add, token.LeftAssoc},
+		{token.Concat, token.LeftAssoc},
+		{token.Land, token.LeftAssoc},
+		{token.Pow, token.RightAssoc},
+		{token.Coalesce, token.RightAssoc},
+		{token.CoalesceAssign, token.RightAssoc},
+		{token.Eq, token.NonAssoc},
+		{token.Lt, token.NonAssoc},
+		{token.Qmark, token.NonAssoc},
+		{token.Not, token.NonAssoc},
+		{token.Ident, token.NonAssoc},
+	}
+	for _, tt := range tests {
+		if got := tt.typ.Associativity(); got != tt.want {
+			t.Errorf("%v: got associativity %d, want %d", tt.typ, got, tt.want)
+		}
+	}
+}
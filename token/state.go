@@ -0,0 +1,114 @@
+package token
+
+import "fmt"
+
+// A State is the state of a Scanner between two pieces of source,
+// e.g. two lines. It tells whether the scanner is in HTML or in PHP code,
+// and what unfinished token (e.g. a block comment or a heredoc) the next
+// piece continues. States are comparable, so a line-based highlighter
+// can rescan lines only until the states converge.
+//
+// The zero State is the state at the beginning of a file.
+type State struct {
+	state uint   // inHTML, inPHP, …
+	cont  uint   // unfinished token
+	delim string // heredoc identifier
+	bol   bool   // heredoc continues at the beginning of a line
+}
+
+// Unfinished tokens.
+const (
+	contNone = iota
+	contComment
+	contDocComment
+	contSingleQuoted
+	contDoubleQuoted
+	contShellExec
+	contHereDoc
+)
+
+var stateNames = [...]string{
+	inHTML:         "HTML",
+	inPHP:          "PHP",
+	inHaltCompiler: "halt compiler",
+	inData:         "data",
+}
+
+var contNames = [...]string{
+	contComment:      "block comment",
+	contDocComment:   "doc comment",
+	contSingleQuoted: "single-quoted string",
+	contDoubleQuoted: "double-quoted string",
+	contShellExec:    "shell command",
+	contHereDoc:      "heredoc",
+}
+
+func (st State) String() string {
+	switch st.cont {
+	case contNone:
+		return stateNames[st.state]
+	case contHereDoc:
+		return fmt.Sprintf("%s in %s %s", stateNames[st.state], contNames[st.cont], st.delim)
+	default:
+		return fmt.Sprintf("%s in %s", stateNames[st.state], contNames[st.cont])
+	}
+}
+
+// NewScannerAt returns a Scanner that scans src, a piece of a file
+// (e.g. a line), starting at the state st. Unlike for whole files,
+// src might end in the middle of a comment, a string or a heredoc. In
+// that case, the token is returned as it is, and State reports it as
+// unfinished, so the piece that follows can be scanned starting at it.
+//
+// The positions of the tokens are relative to the start of src.
+func NewScannerAt(src []byte, st State, opts ...Option) *Scanner {
+	s := NewBytesScanner(src, opts...)
+	s.fragment = true
+	s.state = st.state
+	s.cont, s.delim, s.bol = st.cont, st.delim, st.bol
+	return s
+}
+
+// InPHP makes the Scanner start in PHP code, as if the source
+// followed an opening tag (e.g. to scan snippets of code).
+func InPHP() Option {
+	return func(s *Scanner) { s.state = inPHP }
+}
+
+// State returns the state to scan the source that follows the source
+// of s with. It is meant to be called once Next has returned EOF.
+func (s *Scanner) State() State {
+	return State{state: s.state, cont: s.cont, delim: s.delim, bol: s.bol}
+}
+
+// scanUnfinished scans the rest of the unfinished token the source
+// starts with.
+func (s *Scanner) scanUnfinished() Token {
+	if s.off == len(s.src) {
+		return Token{Type: EOF}
+	}
+	cont, delim, bol := s.cont, s.delim, s.bol
+	s.cont, s.delim, s.bol = contNone, "", false
+	switch cont {
+	case contComment:
+		return s.scanBlockComment(Comment)
+	case contDocComment:
+		return s.scanBlockComment(DocComment)
+	case contSingleQuoted:
+		return s.scanSingleQuoted()
+	case contDoubleQuoted:
+		return s.scanDoubleQuoted()
+	case contShellExec:
+		return s.scanShellExec()
+	case contHereDoc:
+		return s.scanHereDocBody(delim, bol)
+	}
+	panic(fmt.Sprintf("unknown unfinished token: %d", cont))
+}
+
+// unfinished returns the text scanned so far as a token of type typ,
+// which continues in the source that follows, as cont.
+func (s *Scanner) unfinished(typ Type, cont uint) Token {
+	s.cont = cont
+	return Token{Type: typ, Text: s.text()}
+}
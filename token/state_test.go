@@ -0,0 +1,112 @@
+package token_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"mibk.dev/php/token"
+)
+
+func TestState(t *testing.T) {
+	const input = `<p><?php /* a
+b */ $x = 'multi
+line' . <<<"EOT"
+  {$x}
+ EOTA
+  EOT;
+/** doc
+ */ ?>
+<?php $y = ` + "`ls\n-l`" + `;
+__halt_compiler();
+data
+`
+	wantStates := []string{
+		"PHP in block comment",
+		"PHP in single-quoted string",
+		"PHP in heredoc EOT",
+		"PHP in heredoc EOT",
+		"PHP in heredoc EOT",
+		"PHP",
+		"PHP in doc comment",
+		"HTML",
+		"PHP in shell command",
+		"PHP",
+		"data",
+		"data",
+	}
+
+	var (
+		st     token.State
+		states []string
+		text   strings.Builder
+	)
+	for _, line := range strings.SplitAfter(input, "\n") {
+		if line == "" {
+			continue
+		}
+		sc := token.NewScannerAt([]byte(line), st)
+		for tok := sc.Next(); tok.Type != token.EOF; tok = sc.Next() {
+			if tok.Type == token.Illegal {
+				t.Errorf("unexpected %v in %q", tok, line)
+			}
+			text.WriteString(tok.Text)
+		}
+		if err := sc.Err(); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		st = sc.State()
+		states = append(states, st.String())
+	}
+	if diff := cmp.Diff(states, wantStates); diff != "" {
+		t.Errorf("states don't match: (-got +want)\n%s", diff)
+	}
+	if text.String() != input {
+		t.Errorf("tokens don't reconstruct the input:\n%s", text.String())
+	}
+}
+
+func TestStateTokens(t *testing.T) {
+	var st token.State
+	var got []string
+	for _, line := range []string{"<?php /** doc\n", " */ 'a\n", "b'"} {
+		sc := token.NewScannerAt([]byte(line), st)
+		for tok := sc.Next(); tok.Type != token.EOF; tok = sc.Next() {
+			got = append(got, tok.String())
+		}
+		st = sc.State()
+	}
+	want := []string{
+		`<?php`, `Whitespace(" ")`, `DocComment("/** doc\n")`,
+		`DocComment(" */")`, `Whitespace(" ")`, `String("'a\n")`,
+		`String("b'")`,
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("tokens don't match: (-got +want)\n%s", diff)
+	}
+	if st.String() != "PHP" {
+		t.Errorf("got state %v, want PHP", st)
+	}
+}
+
+func TestStateConverge(t *testing.T) {
+	scan := func(src string, st token.State) token.State {
+		sc := token.NewScannerAt([]byte(src), st)
+		for sc.Next().Type != token.EOF {
+		}
+		return sc.State()
+	}
+	start := scan("<?php\n", token.State{})
+	a := scan("$a = 1;\n", start)
+	b := scan("$b = 'x';\n", start)
+	if a != b {
+		t.Errorf("states %v and %v don't converge", a, b)
+	}
+	if c := scan("$c = <<<A\n", start); c == a {
+		t.Errorf("state %v in heredoc equals %v", c, a)
+	}
+	if c, d := scan("$c = <<<A\n", start), scan("$d = <<<B\n", start); c == d {
+		t.Errorf("heredoc states with different identifiers are equal: %v", c)
+	}
+}
@@ -1,7 +1,7 @@
 package token
 
 import (
-	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
@@ -17,6 +17,18 @@ func (e *ScanError) Error() string {
 	return fmt.Sprintf("line:%v: %v", e.Pos, e.Err)
 }
 
+func (e *ScanError) Unwrap() error { return e.Err }
+
+// An ErrorHandler is called for each error the Scanner encounters.
+// After an error, the Scanner returns an Illegal token and continues
+// scanning.
+type ErrorHandler func(err *ScanError)
+
+// WithErrorHandler makes the Scanner report errors to h.
+func WithErrorHandler(h ErrorHandler) Option {
+	return func(s *Scanner) { s.handler = h }
+}
+
 type Pos struct {
 	Line, Column int
 }
@@ -35,7 +47,8 @@ func (t Token) String() string {
 	switch {
 	case t.Type == EOF,
 		symbolStart < t.Type && t.Type < symbolEnd,
-		keywordStart < t.Type && t.Type < keywordEnd:
+		keywordStart < t.Type && t.Type < keywordEnd,
+		magicConstStart < t.Type && t.Type < magicConstEnd:
 		return t.Type.String()
 	default:
 		return fmt.Sprintf("%v(%q)", t.Type, t.Text)
@@ -48,6 +61,31 @@ type Type uint
 
 func (t Type) IsKeyword() bool { return keywordStart < t && t < keywordEnd }
 
+// IsLiteral reports whether t is an identifier, a variable or a basic
+// literal (a number or a string).
+func (t Type) IsLiteral() bool { return Ident <= t && t <= Var }
+
+// IsAssignOp reports whether t is an assignment operator, e.g. = or +=.
+func (t Type) IsAssignOp() bool {
+	return t == Assign || AddAssign <= t && t <= CoalesceAssign
+}
+
+// IsComparison reports whether t is a comparison operator, e.g. < or
+// ===.
+func (t Type) IsComparison() bool {
+	switch t {
+	case Lt, Gt, Leq, Geq, Eq, Neq, Identical, Nidentical, Spaceship:
+		return true
+	}
+	return false
+}
+
+// IsCast reports whether t is a cast operator, e.g. (int).
+func (t Type) IsCast() bool { return IntCast <= t && t <= UnsetCast }
+
+// IsMagicConst reports whether t is a magic constant, e.g. __DIR__.
+func (t Type) IsMagicConst() bool { return magicConstStart < t && t < magicConstEnd }
+
 const (
 	Illegal Type = iota
 	EOF
@@ -59,11 +97,14 @@ const (
 	Int
 	Float
 	String
+	ShellExec // `...`
 	Var
 	InlineHTML
+	BOM // byte order mark
 
 	symbolStart
 	OpenTag   // <?php
+	EchoTag   // <?=
 	CloseTag  // ?>
 	Dollar    // $
 	Backslash // \
@@ -74,6 +115,7 @@ const (
 	Rbrack    // ]
 	Lbrace    // {
 	Rbrace    // }
+	AttrStart // #[
 
 	Add      // +
 	Sub      // -
@@ -126,152 +168,334 @@ const (
 	QmarkArrow  // ?->
 	DoubleArrow // =>
 	Spaceship   // <=>
+	At          // @
+	Tilde       // ~
+
+	IntCast    // (int)
+	FloatCast  // (float)
+	StringCast // (string)
+	BoolCast   // (bool)
+	ArrayCast  // (array)
+	ObjectCast // (object)
+	UnsetCast  // (unset)
 	symbolEnd
 
 	keywordStart
-	Abstract   // abstract
-	As         // as
-	Break      // break
-	Case       // case
-	Catch      // catch
-	Class      // class
-	Clone      // clone
-	Const      // const
-	Continue   // continue
-	Declare    // declare
-	Default    // default
-	Do         // do
-	Else       // else
-	Enum       // enum
-	Extends    // extends
-	Final      // final
-	Finally    // finally
-	Fn         // fn
-	For        // for
-	Foreach    // foreach
-	From       // from
-	Function   // function
-	Global     // global
-	Goto       // goto
-	If         // if
-	Implements // implements
-	Instanceof // instanceof
-	Insteadof  // insteadof
-	Interface  // interface
-	Match      // match
-	Namespace  // namespace
-	New        // new
-	Private    // private
-	Protected  // protected
-	Public     // public
-	Readonly   // readonly
-	Return     // return
-	Static     // static
-	Switch     // switch
-	Throw      // throw
-	Trait      // trait
-	Try        // try
-	Use        // use
-	Lxor       // xor
-	While      // while
-	Yield      // yield
+	Abstract     // abstract
+	Array        // array
+	As           // as
+	Break        // break
+	Callable     // callable
+	Case         // case
+	Catch        // catch
+	Class        // class
+	Clone        // clone
+	Const        // const
+	Continue     // continue
+	Declare      // declare
+	Default      // default
+	Do           // do
+	Echo         // echo
+	Else         // else
+	Empty        // empty
+	Enddeclare   // enddeclare
+	Endfor       // endfor
+	Endforeach   // endforeach
+	Endif        // endif
+	Endswitch    // endswitch
+	Endwhile     // endwhile
+	Enum         // enum
+	Eval         // eval
+	Exit         // exit
+	Extends      // extends
+	Final        // final
+	Finally      // finally
+	Fn           // fn
+	For          // for
+	Foreach      // foreach
+	From         // from
+	Function     // function
+	Global       // global
+	Goto         // goto
+	HaltCompiler // __halt_compiler
+	If           // if
+	Implements   // implements
+	Include      // include
+	IncludeOnce  // include_once
+	Instanceof   // instanceof
+	Insteadof    // insteadof
+	Interface    // interface
+	Isset        // isset
+	List         // list
+	Match        // match
+	Namespace    // namespace
+	New          // new
+	Print        // print
+	Private      // private
+	Protected    // protected
+	Public       // public
+	Readonly     // readonly
+	Require      // require
+	RequireOnce  // require_once
+	Return       // return
+	Static       // static
+	Switch       // switch
+	Throw        // throw
+	Trait        // trait
+	Try          // try
+	Unset        // unset
+	Use          // use
+	VarKeyword   // var
+	Lxor         // xor
+	While        // while
+	Yield        // yield
 	keywordEnd
+
+	magicConstStart
+	MagicClass     // __CLASS__
+	MagicDir       // __DIR__
+	MagicFile      // __FILE__
+	MagicFunction  // __FUNCTION__
+	MagicLine      // __LINE__
+	MagicMethod    // __METHOD__
+	MagicNamespace // __NAMESPACE__
+	MagicTrait     // __TRAIT__
+	magicConstEnd
 )
 
 var keywords map[string]Token
 
+// maxKeywordLen is the length of the longest keyword.
+const maxKeywordLen = len("__halt_compiler")
+
 func init() {
 	keywords = make(map[string]Token)
 	for typ := keywordStart + 1; typ < keywordEnd; typ++ {
 		s := typ.String()
 		keywords[s] = Token{Type: typ}
 	}
+	for typ := magicConstStart + 1; typ < magicConstEnd; typ++ {
+		s := strings.ToLower(typ.String())
+		keywords[s] = Token{Type: typ}
+	}
 
 	// Special keywords: aliases for logical operators.
 	keywords["and"] = Token{Type: Land}
 	keywords["or"] = Token{Type: Lor}
+
+	// Other aliases.
+	keywords["die"] = Token{Type: Exit}
 }
 
 const eof = -1
 
+// bom is the UTF-8 byte order mark.
+const bom = "\uFEFF"
+
 const (
 	inHTML = iota
 	inPHP
+	inHaltCompiler // between __halt_compiler and ; (or ?>)
+	inData         // after __halt_compiler();
 )
 
+// A Scanner scans PHP source held in memory. The texts of the tokens
+// are substrings of the source, so scanning doesn't copy them.
 type Scanner struct {
-	r     *bufio.Reader
-	state uint
-	queue []Token
-	done  bool
-	err   error
+	src      string
+	off      int // reading offset
+	start    int // offset of the current token
+	startPos Pos // position of the current token
+	w        int // width of the last rune read (for unread)
+	version  Version
+	mode     Mode
+	state    uint
+	queue    []Token
+	prev     Type // last token other than whitespace or comments
+
+	// In pieces of files (see NewScannerAt), tokens might be
+	// unfinished.
+	fragment bool
+	cont     uint
+	delim    string
+	bol      bool
+
+	err        error // first error
+	handler    ErrorHandler
+	errorCount int
+
+	space    Token   // skipped whitespace before the last token
+	comments []Token // collected comments
 
 	line, col   int
 	lastLineLen int
 }
 
-func NewScanner(r io.Reader) *Scanner {
-	return &Scanner{
-		r:    bufio.NewReader(r),
-		line: 1,
-		col:  1,
+// NewScanner returns a Scanner that scans the whole content of r. A
+// read error is reported by Err after the content read so far has been
+// scanned.
+func NewScanner(r io.Reader, opts ...Option) *Scanner {
+	src, err := io.ReadAll(r)
+	s := NewBytesScanner(src, opts...)
+	s.err = err
+	return s
+}
+
+// NewBytesScanner returns a Scanner that scans src. The source is
+// copied once; src might be modified once the function returns.
+func NewBytesScanner(src []byte, opts ...Option) *Scanner {
+	s := &Scanner{
+		src:     string(src),
+		version: Latest,
+		mode:    DefaultMode,
+		line:    1,
+		col:     1,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
-func (s *Scanner) Next() (tok Token) {
-	defer func() {
-		switch tok.Type {
-		case OpenTag:
-			s.state = inPHP
-		case CloseTag:
-			s.state = inHTML
+// Next returns the next token. Depending on the mode, whitespace and
+// comments might be skipped.
+func (s *Scanner) Next() Token {
+	s.space = Token{}
+	for {
+		tok := s.next()
+		s.update(tok)
+		if !s.skip(&tok) {
+			return tok
 		}
-	}()
+	}
+}
+
+// update updates the state of s after scanning tok.
+func (s *Scanner) update(tok Token) {
+	switch {
+	case s.state == inHaltCompiler && (tok.Type == Semicolon || tok.Type == CloseTag):
+		// Everything after __halt_compiler(); is raw data.
+		s.state = inData
+	case tok.Type == OpenTag, tok.Type == EchoTag:
+		s.state = inPHP
+	case tok.Type == CloseTag:
+		s.state = inHTML
+	case tok.Type == HaltCompiler:
+		s.state = inHaltCompiler
+	}
+	switch tok.Type {
+	case Whitespace, Comment, DocComment:
+	default:
+		s.prev = tok.Type
+	}
+}
 
+func (s *Scanner) next() (tok Token) {
 	if len(s.queue) > 0 {
 		tok, s.queue = s.queue[0], s.queue[1:]
 		return tok
 	}
 
 	pos := s.pos()
+	s.start, s.startPos = s.off, pos
+	if s.off == 0 && s.state == inHTML && strings.HasPrefix(s.src, bom) {
+		// The BOM doesn't take up a column.
+		s.off += len(bom)
+		return Token{Type: BOM, Text: bom, Pos: pos}
+	}
 	switch s.state {
 	default:
 		panic(fmt.Sprintf("unknown state: %d", s.state))
 	case inHTML:
 		tok = s.scanInlineHTML()
-	case inPHP:
+	case inData:
+		tok = s.scanData()
+	case inPHP, inHaltCompiler:
+		if s.cont != contNone {
+			tok = s.scanUnfinished()
+			break
+		}
 		tok = s.scanAny()
 		if typ := tok.Type; tok.Text == "" && symbolStart < typ && typ < symbolEnd {
 			tok.Text = typ.String()
 		}
 	}
+	if s.version < Latest {
+		if v, what := MinVersion(tok); v > s.version {
+			s.error(pos, fmt.Errorf("%s requires PHP %v", what, v))
+			tok.Type = Illegal
+		}
+	}
 	tok.Pos = pos
 	return tok
 }
 
+// Err returns the first error encountered while scanning.
 func (s *Scanner) Err() error { return s.err }
 
-func (s *Scanner) errorf(format string, args ...interface{}) Token {
+// ErrorCount returns the number of errors encountered so far.
+func (s *Scanner) ErrorCount() int { return s.errorCount }
+
+func (s *Scanner) error(pos Pos, err error) {
+	se := &ScanError{pos, err}
 	if s.err == nil {
-		s.err = &ScanError{s.pos(), fmt.Errorf(format, args...)}
+		s.err = se
+	}
+	s.errorCount++
+	if s.handler != nil {
+		s.handler(se)
+	}
+}
+
+// errorf reports an error at the current position and returns the
+// text scanned so far as an Illegal token.
+func (s *Scanner) errorf(format string, args ...interface{}) Token {
+	return s.errorAt(s.pos(), format, args...)
+}
+
+func (s *Scanner) errorAt(pos Pos, format string, args ...interface{}) Token {
+	s.error(pos, fmt.Errorf(format, args...))
+	return Token{Type: Illegal, Text: s.text()}
+}
+
+// unterminated reports an unterminated literal. As the literal might
+// span multiple lines, the rest of the source is not lost: scanning
+// resumes at the end of its first line.
+func (s *Scanner) unterminated(what string) Token {
+	if i := strings.IndexByte(s.text(), '\n'); i >= 0 {
+		s.off = s.start + i
+		s.w = 0
+		s.line = s.startPos.Line
+		s.col = s.startPos.Column + utf8.RuneCountInString(s.text())
+	}
+	return s.errorf("%s not terminated", what)
+}
+
+// skipLine skips the rest of the line, not including the newline.
+func (s *Scanner) skipLine() {
+	i := strings.IndexByte(s.src[s.off:], '\n')
+	if i < 0 {
+		i = len(s.src) - s.off
 	}
-	return Token{Type: EOF}
+	s.advance(i)
 }
 
 func (s *Scanner) pos() Pos { return Pos{Line: s.line, Column: s.col} }
 
+// text returns the text of the current token scanned so far.
+func (s *Scanner) text() string { return s.src[s.start:s.off] }
+
 func (s *Scanner) read() rune {
-	if s.done {
+	if s.off >= len(s.src) {
+		s.w = 0
 		return eof
 	}
-	r, _, err := s.r.ReadRune()
-	if err != nil {
-		if err != io.EOF {
-			s.err = err
-		}
-		s.done = true
-		return eof
+	r, w := rune(s.src[s.off]), 1
+	if r >= utf8.RuneSelf {
+		r, w = utf8.DecodeRuneInString(s.src[s.off:])
 	}
+	s.off += w
+	s.w = w
 	if r == '\n' {
 		s.line++
 		s.lastLineLen, s.col = s.col, 1
@@ -281,14 +505,13 @@ func (s *Scanner) read() rune {
 	return r
 }
 
+// unread unreads the last rune read. Only one rune can be unread.
 func (s *Scanner) unread() {
-	if s.done {
+	if s.w == 0 {
 		return
 	}
-	if err := s.r.UnreadRune(); err != nil {
-		// UnreadRune returns an error only on invalid use.
-		panic(err)
-	}
+	s.off -= s.w
+	s.w = 0
 	s.col--
 	if s.col == 0 {
 		s.col = s.lastLineLen
@@ -297,36 +520,63 @@ func (s *Scanner) unread() {
 }
 
 func (s *Scanner) peek() rune {
-	r := s.read()
-	s.unread()
+	if s.off >= len(s.src) {
+		return eof
+	}
+	if c := s.src[s.off]; c < utf8.RuneSelf {
+		return rune(c)
+	}
+	r, _ := utf8.DecodeRuneInString(s.src[s.off:])
 	return r
 }
 
-func (s *Scanner) scanAny() (tok Token) {
-	defer func() {
-		if Add <= tok.Type && tok.Type <= Coalesce && s.peek() == '=' {
-			s.read()
-			tok.Type += AddAssign - Add
-		}
-	}()
+// advance skips n bytes, which is faster than reading them rune by
+// rune.
+func (s *Scanner) advance(n int) {
+	text := s.src[s.off : s.off+n]
+	if i := strings.LastIndexByte(text, '\n'); i >= 0 {
+		s.line += strings.Count(text, "\n")
+		s.col = 1
+		text = text[i+1:]
+	}
+	s.col += utf8.RuneCountInString(text)
+	s.off += n
+	s.w = 0
+}
+
+func (s *Scanner) scanAny() Token {
+	tok := s.scanToken()
+	if Add <= tok.Type && tok.Type <= Coalesce && s.peek() == '=' {
+		s.read()
+		tok.Type += AddAssign - Add
+	}
+	return tok
+}
+
+func (s *Scanner) scanToken() Token {
 	switch r := s.read(); r {
 	case eof:
 		return Token{Type: EOF}
 	case '/':
 		switch s.read() {
 		case '/':
-			return s.scanLineComment("//")
+			return s.scanLineComment()
 		case '*':
-			return s.scanBlockComment()
+			return s.scanBlockComment(Comment)
 		default:
 			s.unread()
 			return Token{Type: Quo}
 		}
 	case '#':
-		return s.scanLineComment("#")
+		if s.peek() == '[' && s.version >= PHP80 {
+			// Attributes were comments before.
+			s.read()
+			return Token{Type: AttrStart}
+		}
+		return s.scanLineComment()
 	case '$':
 		if id := s.scanIdent(); id != "" {
-			return Token{Type: Var, Text: "$" + id}
+			return Token{Type: Var, Text: s.text()}
 		}
 		return Token{Type: Dollar}
 	case '\\':
@@ -354,6 +604,9 @@ func (s *Scanner) scanAny() (tok Token) {
 			return Token{Type: Qmark}
 		}
 	case '(':
+		if tok, ok := s.scanCast(); ok {
+			return tok
+		}
 		return Token{Type: Lparen}
 	case ')':
 		return Token{Type: Rparen}
@@ -455,9 +708,7 @@ func (s *Scanner) scanAny() (tok Token) {
 			s.read()
 			return Token{Type: Ellipsis}
 		case isDigit(r2):
-			b := new(strings.Builder)
-			b.WriteRune(r)
-			return s.scanFloat(b)
+			return s.scanFloat()
 		default:
 			return Token{Type: Concat}
 		}
@@ -485,6 +736,10 @@ func (s *Scanner) scanAny() (tok Token) {
 		return Token{Type: And}
 	case '^':
 		return Token{Type: Xor}
+	case '@':
+		return Token{Type: At}
+	case '~':
+		return Token{Type: Tilde}
 	case ' ', '\t', '\r', '\n':
 		s.unread()
 		return s.scanWhitespace()
@@ -492,18 +747,19 @@ func (s *Scanner) scanAny() (tok Token) {
 		return s.scanSingleQuoted()
 	case '"':
 		return s.scanDoubleQuoted()
+	case '`':
+		return s.scanShellExec()
 	default:
 		if isDigit(r) {
 			return s.scanNumber(r)
 		}
 		s.unread()
 		if id := s.scanIdent(); id != "" {
-			k := strings.ToLower(id)
-			if tok, ok := keywords[k]; ok {
+			if tok, ok := lookupKeyword(id); ok && s.isKeyword(tok.Type) {
 				tok.Text = id
 				return tok
 			}
-			if k == "elseif" {
+			if strings.EqualFold(id, "elseif") {
 				// Ugly special case.
 				t := Token{Type: If, Text: id[4:]}
 				t.Pos = s.pos()
@@ -514,137 +770,233 @@ func (s *Scanner) scanAny() (tok Token) {
 			return Token{Type: Ident, Text: id}
 		}
 		s.read()
-		return Token{Type: Illegal, Text: string(r)}
+		return Token{Type: Illegal, Text: s.text()}
+	}
+}
+
+// Lookup returns the keyword type (or the magic constant type) of
+// ident, which is case-insensitive, or Ident if ident is not a keyword.
+// Contextual keywords (e.g. enum) are always reported as keywords. The
+// logical operators "and" and "or" are reported as Land and Lor.
+func Lookup(ident string) Type {
+	if tok, ok := lookupKeyword(ident); ok {
+		return tok.Type
+	}
+	return Ident
+}
+
+// lookupKeyword looks up the keyword token for id, which is
+// case-insensitive. Unlike strings.ToLower, it doesn't allocate.
+func lookupKeyword(id string) (Token, bool) {
+	if len(id) > maxKeywordLen {
+		return Token{}, false
 	}
+	var buf [maxKeywordLen]byte
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		buf[i] = c
+	}
+	tok, ok := keywords[string(buf[:len(id)])]
+	return tok, ok
+}
+
+var casts = map[string]Type{
+	"int":     IntCast,
+	"integer": IntCast,
+	"float":   FloatCast,
+	"double":  FloatCast,
+	"real":    FloatCast,
+	"string":  StringCast,
+	"binary":  StringCast,
+	"bool":    BoolCast,
+	"boolean": BoolCast,
+	"array":   ArrayCast,
+	"object":  ObjectCast,
+	"unset":   UnsetCast,
+}
+
+// scanCast scans the rest of a cast operator after "(", if there is
+// one. The type name is case-insensitive and it might be surrounded
+// by spaces and tabs, e.g. ( INT ).
+func (s *Scanner) scanCast() (Token, bool) {
+	typ, size := matchCast(s.src[s.off:])
+	if size == 0 {
+		return Token{}, false
+	}
+	// The cast consists only of ASCII characters.
+	s.advance(size)
+	return Token{Type: typ, Text: s.text()}, true
+}
+
+// matchCast returns the type and the size of a cast operator (without
+// the opening parenthesis) at the start of buf. If there is no cast,
+// the size is 0.
+func matchCast(buf string) (typ Type, size int) {
+	i := skipSpace(buf, 0)
+	j := i
+	for j < len(buf) && ('a' <= buf[j]|0x20 && buf[j]|0x20 <= 'z') {
+		j++
+	}
+	k := skipSpace(buf, j)
+	if k == len(buf) || buf[k] != ')' || j-i > len("boolean") {
+		return Illegal, 0
+	}
+	typ, ok := casts[strings.ToLower(buf[i:j])]
+	if !ok {
+		return Illegal, 0
+	}
+	return typ, k + 1
+}
+
+func skipSpace(buf string, i int) int {
+	for i < len(buf) && (buf[i] == ' ' || buf[i] == '\t') {
+		i++
+	}
+	return i
 }
 
 func (s *Scanner) scanInlineHTML() Token {
-	const openTag = "<?php"
-	var i int
-	var canEnd bool
-	var b strings.Builder
 	for {
-		switch r := s.read(); r {
-		case rune(openTag[i]):
-			i++
-			if i == len(openTag) {
-				canEnd = true
-				i = 0
+		i := strings.IndexByte(s.src[s.off:], '<')
+		if i < 0 {
+			s.advance(len(s.src) - s.off)
+			if s.off == s.start {
+				return Token{Type: EOF}
 			}
-		case ' ', '\t', '\r', '\n':
-			if canEnd {
-				s.unread()
-				tok := Token{Type: OpenTag, Text: openTag}
-				if b.Len() > 0 {
-					tok.Pos.Line, tok.Pos.Column = s.line, s.col-len(openTag)
-					s.queue = append(s.queue, tok)
-					tok = Token{Type: InlineHTML, Text: b.String()}
-				}
-				return tok
-			}
-			fallthrough
-		default:
-			if canEnd {
-				i = len(openTag)
-			}
-			canEnd = false
-			b.WriteString(openTag[:i])
-			if r == eof {
-				if b.Len() == 0 {
-					return Token{Type: EOF}
-				}
-				s.unread()
-				return Token{Type: InlineHTML, Text: b.String()}
-			}
-			i = 0
-			b.WriteRune(r)
+			return Token{Type: InlineHTML, Text: s.text()}
+		}
+		s.advance(i)
+		pos, end := s.pos(), s.off
+		s.read()
+		tok, ok := s.scanOpenTag()
+		if !ok {
+			continue
 		}
+		if end > s.start {
+			tok.Pos = pos
+			s.queue = append(s.queue, tok)
+			tok = Token{Type: InlineHTML, Text: s.src[s.start:end]}
+		}
+		return tok
+	}
+}
+
+// scanOpenTag scans the rest of an open tag after "<", if there is
+// one. The <?php tag must be followed by whitespace or EOF.
+func (s *Scanner) scanOpenTag() (Token, bool) {
+	buf := s.src[s.off:]
+	start := s.off - len("<")
+	switch {
+	case strings.HasPrefix(buf, "?="):
+		s.advance(len("?="))
+		return Token{Type: EchoTag, Text: s.src[start:s.off]}, true
+	case len(buf) >= 4 && strings.EqualFold(buf[:4], "?php"):
+		if len(buf) > 4 && !isSpace(buf[4]) {
+			return Token{}, false
+		}
+		s.advance(len("?php"))
+		return Token{Type: OpenTag, Text: s.src[start:s.off]}, true
 	}
+	return Token{}, false
 }
 
-func (s *Scanner) scanLineComment(start string) Token {
-	var b strings.Builder
+func isSpace(c byte) bool { return c == ' ' || c == '\t' || c == '\r' || c == '\n' }
+
+// scanData scans the raw data after __halt_compiler(); as inline
+// HTML, just like PHP does.
+func (s *Scanner) scanData() Token {
+	if s.off == len(s.src) {
+		return Token{Type: EOF}
+	}
+	s.advance(len(s.src) - s.off)
+	return Token{Type: InlineHTML, Text: s.text()}
+}
+
+func (s *Scanner) scanLineComment() Token {
 	for {
 		switch r := s.read(); r {
 		case '?':
 			// Close tags end line comments, too.
 			if s.peek() == '>' {
+				tok := Token{Type: Comment, Text: s.src[s.start : s.off-1]}
 				s.read()
-				tok := Token{Type: CloseTag, Text: "?>"}
-				tok.Pos.Line, tok.Pos.Column = s.line, s.col-2
-				s.queue = append(s.queue, tok)
-				return Token{Type: Comment, Text: start + b.String()}
+				tag := Token{Type: CloseTag, Text: s.src[s.off-2 : s.off]}
+				tag.Pos.Line, tag.Pos.Column = s.line, s.col-2
+				s.queue = append(s.queue, tag)
+				return tok
 			}
-			fallthrough
-		default:
-			b.WriteRune(r)
 		case '\n', eof:
 			s.unread()
-			return Token{Type: Comment, Text: start + b.String()}
+			return Token{Type: Comment, Text: s.text()}
 		}
 	}
 }
 
-func (s *Scanner) scanBlockComment() Token {
-	var b strings.Builder
+// scanBlockComment scans a comment of type typ. It might turn out to
+// be a doc comment, though.
+func (s *Scanner) scanBlockComment(typ Type) Token {
 	for {
 		switch r := s.read(); {
-		default:
-			b.WriteRune(r)
 		case r == '*' && s.peek() == '/':
 			s.read()
-			tok := Token{Type: Comment, Text: "/*" + b.String() + "*/"}
-			if rest, ok := strings.CutPrefix(tok.Text, "/**"); ok {
-				switch rest[0] {
-				case ' ', '\t', '\r', '\n':
-					tok.Type = DocComment
+			return Token{Type: s.commentType(typ), Text: s.text()}
+		case r == eof:
+			if s.fragment {
+				if typ = s.commentType(typ); typ == DocComment {
+					return s.unfinished(typ, contDocComment)
 				}
+				return s.unfinished(typ, contComment)
 			}
-			return tok
-		case r == eof:
 			return s.errorf("unterminated block comment")
 		}
 	}
 }
 
+func (s *Scanner) commentType(typ Type) Type {
+	if rest, ok := strings.CutPrefix(s.text(), "/**"); ok && rest != "" {
+		switch rest[0] {
+		case ' ', '\t', '\r', '\n':
+			return DocComment
+		}
+	}
+	return typ
+}
+
 func (s *Scanner) scanIdent() string {
-	var b strings.Builder
+	start := s.off
 	for {
-		switch r := s.read(); {
+		switch r := s.peek(); {
 		case r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= utf8.RuneSelf:
-			b.WriteRune(r)
+			s.read()
 		case r >= '0' && r <= '9':
-			if b.Len() > 0 {
-				b.WriteRune(r)
+			if s.off > start {
+				s.read()
 				continue
 			}
 			fallthrough
 		default:
-			s.unread()
-			return b.String()
+			return s.src[start:s.off]
 		}
 	}
 }
 
 func (s *Scanner) scanWhitespace() Token {
-	var b strings.Builder
 	for {
-		switch r := s.read(); r {
+		switch s.peek() {
 		case ' ', '\t', '\r', '\n':
-			b.WriteRune(r)
+			s.read()
 		default:
-			s.unread()
-			return Token{Type: Whitespace, Text: b.String()}
+			return Token{Type: Whitespace, Text: s.text()}
 		}
 	}
 }
 
 func (s *Scanner) scanSingleQuoted() Token {
-	var b strings.Builder
 	for {
-		r := s.read()
-		b.WriteRune(r)
-		switch r {
+		switch s.read() {
 		case '\\':
 			// It would be nice if PHP disallowed unknown escape
 			// sequences. Was tempted to disallow it here but then
@@ -654,120 +1006,213 @@ func (s *Scanner) scanSingleQuoted() Token {
 			//	'\\d+.\\d{1,2}'
 			//
 			// Be compatible with PHP for now.
-			b.WriteRune(s.read())
+			s.read()
 		case '\'':
-			return Token{Type: String, Text: "'" + b.String()}
+			return Token{Type: String, Text: s.text()}
 		case eof:
-			return s.errorf("string not terminated")
+			if s.fragment {
+				return s.unfinished(String, contSingleQuoted)
+			}
+			return s.unterminated("string")
 		}
 	}
 }
 
 func (s *Scanner) scanDoubleQuoted() Token {
-	var b strings.Builder
 	for {
-		r := s.read()
-		b.WriteRune(r)
-		switch r {
+		switch s.read() {
 		case '\\':
 			// Allow all escape sequences, even unknown ones.
 			// Be compatible with PHP for now.
-			b.WriteRune(s.read())
+			s.read()
 		case '"':
-			return Token{Type: String, Text: `"` + b.String()}
+			return Token{Type: String, Text: s.text()}
 		case eof:
-			return s.errorf("string not terminated")
+			if s.fragment {
+				return s.unfinished(String, contDoubleQuoted)
+			}
+			return s.unterminated("string")
+		}
+	}
+}
+
+func (s *Scanner) scanShellExec() Token {
+	for {
+		switch s.read() {
+		case '\\':
+			s.read()
+		case '`':
+			return Token{Type: ShellExec, Text: s.text()}
+		case eof:
+			if s.fragment {
+				return s.unfinished(ShellExec, contShellExec)
+			}
+			return s.unterminated("shell command")
 		}
 	}
 }
 
 func (s *Scanner) scanHereDoc() Token {
-	var b strings.Builder
-	ws := s.scanWhitespace()
-	if strings.ContainsAny(ws.Text, "\r\n") || s.peek() == eof {
-		// TODO: err position might be wrong.
-		return s.errorf("missing opening heredoc identifier")
+	s.scanIndent()
+	if r := s.peek(); r == '\r' || r == '\n' || r == eof {
+		pos := s.pos()
+		s.skipLine()
+		return s.errorAt(pos, "missing opening heredoc identifier")
 	}
-	b.WriteString(ws.Text)
 	var quote rune
 	switch r := s.peek(); r {
 	case '"', '\'':
 		s.read()
-		b.WriteRune(r)
 		quote = r
 	}
 	delim := s.scanIdent()
 	if delim == "" {
-		return s.errorf("invalid opening heredoc identifier")
+		pos := s.pos()
+		s.skipLine()
+		return s.errorAt(pos, "invalid opening heredoc identifier")
 	}
-	b.WriteString(delim)
 	if quote != 0 {
 		if s.read() != quote {
+			pos := s.pos()
+			s.unread()
+			s.skipLine()
 			// TODO: Different message for nowdoc?
-			return s.errorf("quoted heredoc identifier not terminated")
+			return s.errorAt(pos, "quoted heredoc identifier not terminated")
 		}
-		b.WriteRune(quote)
 	}
 
 SkipWS:
 	for {
 		switch r := s.read(); r {
 		case ' ', '\t', '\r':
-			b.WriteRune(r)
-		case '\n':
+		case '\n', eof:
 			s.unread()
 			break SkipWS
 		default:
 			s.unread()
-			return s.errorf("unexpected %q after heredoc identifier, expecting newline", r)
+			pos := s.pos()
+			s.skipLine()
+			return s.errorAt(pos, "unexpected %q after heredoc identifier, expecting newline", r)
 		}
 	}
 
+	return s.scanHereDocBody(delim, false)
+}
+
+// scanHereDocBody scans the body of a heredoc (or a nowdoc) and its
+// closing identifier delim. If bol is set, the body continues at the
+// beginning of a line.
+func (s *Scanner) scanHereDocBody(delim string, bol bool) Token {
+	type bodyLine struct {
+		pos    Pos
+		indent string
+	}
+	var lines []bodyLine
 	for {
-		// TODO: Check escape characters for heredoc.
-		r := s.read()
-		b.WriteRune(r)
-		switch r {
-		case '\n':
-			// As of PHP 7.3, skip WS.
-			// TODO: Check the indentation is the same for all Heredoc lines.
-			ws := s.scanWhitespace()
-			b.WriteString(ws.Text)
+		if bol {
+			// As of PHP 7.3, the closing identifier may be indented.
+			pos := s.pos()
+			indent := s.scanIndent()
 
+			// The identifier is scanned as a whole, so a longer
+			// identifier that merely starts with delim (e.g.
+			// ENDING for END) doesn't close the heredoc.
 			id := s.scanIdent()
-			b.WriteString(id)
 			if id == delim {
-				return Token{Type: String, Text: "<<<" + b.String()}
+				if err := checkHereDocIndent(indent); err != nil {
+					return s.errorAt(pos, "%v", err)
+				}
+				for _, l := range lines {
+					if err := checkHereDocBodyIndent(l.indent, indent); err != nil {
+						return s.errorAt(l.pos, "%v", err)
+					}
+				}
+				return Token{Type: String, Text: s.text()}
 			}
+			if id != "" || !isLineEnd(s.peek()) {
+				// Only lines that are not blank must be indented.
+				lines = append(lines, bodyLine{pos, indent})
+			}
+		}
+		// TODO: Check escape characters for heredoc.
+		switch s.read() {
+		case '\n':
+			bol = true
 		case eof:
+			if s.fragment {
+				s.delim, s.bol = delim, bol
+				return s.unfinished(String, contHereDoc)
+			}
 			return s.errorf("heredoc not terminated")
+		default:
+			bol = false
+		}
+	}
+}
+
+var errMixedIndent = errors.New("invalid indentation - tabs and spaces cannot be mixed")
+
+func checkHereDocIndent(indent string) error {
+	if strings.Contains(indent, " ") && strings.Contains(indent, "\t") {
+		return errMixedIndent
+	}
+	return nil
+}
+
+// checkHereDocBodyIndent checks that the indentation of a heredoc body
+// line matches the indentation of the closing identifier.
+func checkHereDocBodyIndent(indent, closing string) error {
+	for i := 0; i < len(indent) && i < len(closing); i++ {
+		if indent[i] != closing[0] {
+			return errMixedIndent
+		}
+	}
+	if len(indent) < len(closing) {
+		return fmt.Errorf("invalid body indentation level (expecting an indentation level of at least %d)", len(closing))
+	}
+	return nil
+}
+
+// scanIndent scans spaces and tabs.
+func (s *Scanner) scanIndent() string {
+	start := s.off
+	for {
+		switch s.peek() {
+		case ' ', '\t':
+			s.read()
+		default:
+			return s.src[start:s.off]
 		}
 	}
 }
 
+func isLineEnd(r rune) bool { return r == '\r' || r == '\n' || r == eof }
+
 func (s *Scanner) scanNumber(r rune) Token {
 	if r == '0' {
 		switch r := s.peek(); {
 		case isDigit(r):
 			return s.scanOctal()
+		case r == 'o' || r == 'O':
+			s.read()
+			return s.scanOctal()
 		case r == 'x' || r == 'X':
-			return s.scanHexa(s.read())
+			s.read()
+			return s.scanHexa()
 		case r == 'b' || r == 'B':
-			return s.scanBinary(s.read())
+			s.read()
+			return s.scanBinary()
 		}
 	}
-	b := new(strings.Builder)
-	b.WriteRune(r)
-	if !s.scanDecimal(b) {
-		return Token{Type: Illegal, Text: b.String()}
+	if !s.scanDecimal() {
+		return Token{Type: Illegal, Text: s.text()}
 	}
 	tok := Token{Type: Int}
 	if s.peek() == '.' {
 		s.read()
 		if isDigit(s.peek()) {
-			b.WriteRune('.')
-			if !s.scanDecimal(b) {
-				return Token{Type: Illegal, Text: b.String()}
+			if !s.scanDecimal() {
+				return Token{Type: Illegal, Text: s.text()}
 			}
 			tok.Type = Float
 		} else {
@@ -775,87 +1220,124 @@ func (s *Scanner) scanNumber(r rune) Token {
 			cat.Pos = s.pos()
 			cat.Pos.Column -= 1
 			s.queue = append(s.queue, cat)
-			return Token{Type: Int, Text: b.String()}
+			return Token{Type: Int, Text: s.src[s.start : s.off-1]}
 		}
 	}
 	switch s.peek() {
 	case 'e', 'E':
-		return s.scanFloat(b)
+		return s.scanFloat()
 	}
-	tok.Text = b.String()
+	tok.Text = s.text()
 	return tok
 }
 
-func (s *Scanner) scanDecimal(b *strings.Builder) bool {
+func (s *Scanner) scanDecimal() bool {
 	for {
-		if b.Len() > 0 && s.peek() == '_' {
-			b.WriteRune(s.read())
+		if s.off > s.start && s.peek() == '_' {
+			s.read()
 			if !isDigit(s.peek()) {
-				b.WriteRune(s.read())
+				s.read()
 				return false
 			}
 		}
 		if !isDigit(s.peek()) {
 			break
 		}
-		b.WriteRune(s.read())
-
+		s.read()
 	}
-	return b.Len() > 0
+	return s.off > s.start
 }
 
 func (s *Scanner) scanOctal() Token {
-	var b strings.Builder
 	for {
 		switch r := s.peek(); r {
 		default:
-			return Token{Type: Int, Text: "0" + b.String()}
+			return Token{Type: Int, Text: s.text()}
 		case '8', '9':
-			return s.errorf("invalid digit %c in octal literal", r)
+			pos := s.pos()
+			for r := s.peek(); isDigit(r) || r == '_'; r = s.peek() {
+				s.read()
+			}
+			return s.errorAt(pos, "invalid digit %c in octal literal", r)
+		case '_':
+			if !s.scanSeparator(isOctal) {
+				return Token{Type: Illegal, Text: s.text()}
+			}
 		case '0', '1', '2', '3', '4', '5', '6', '7':
-			b.WriteRune(s.read())
+			s.read()
 		}
 	}
 }
 
-func (s *Scanner) scanHexa(delim rune) Token {
-	var b strings.Builder
+func (s *Scanner) scanHexa() Token {
 	for {
 		switch r := s.peek(); {
 		default:
-			return Token{Type: Int, Text: "0" + string(delim) + b.String()}
-		case isDigit(r) || 'a' <= r && r <= 'f' || 'A' <= r && r <= 'F':
-			b.WriteRune(s.read())
+			return Token{Type: Int, Text: s.text()}
+		case r == '_':
+			if !s.scanSeparator(isHex) {
+				return Token{Type: Illegal, Text: s.text()}
+			}
+		case isHex(r):
+			s.read()
 		}
 	}
 }
 
-func (s *Scanner) scanBinary(delim rune) Token {
-	var b strings.Builder
+func (s *Scanner) scanBinary() Token {
 	for {
 		switch r := s.peek(); r {
 		default:
-			return Token{Type: Int, Text: "0" + string(delim) + b.String()}
+			return Token{Type: Int, Text: s.text()}
+		case '_':
+			if !s.scanSeparator(isBinary) {
+				return Token{Type: Illegal, Text: s.text()}
+			}
 		case '0', '1':
-			b.WriteRune(s.read())
+			s.read()
 		}
 	}
 }
 
-func (s *Scanner) scanFloat(b *strings.Builder) Token {
-	if !s.scanDecimal(b) {
-		return Token{Type: Illegal, Text: b.String()}
+// scanSeparator scans a numeric literal separator (as of PHP 7.4),
+// which must be placed between two valid digits.
+func (s *Scanner) scanSeparator(valid func(rune) bool) bool {
+	str := s.text()
+	last, _ := utf8.DecodeLastRuneInString(str)
+	ok := valid(last) && !isPrefix(str)
+	s.read()
+	if !ok || !valid(s.peek()) {
+		s.read()
+		return false
+	}
+	return true
+}
+
+func (s *Scanner) scanFloat() Token {
+	if !s.scanDecimal() {
+		return Token{Type: Illegal, Text: s.text()}
 	}
 	if r := s.peek(); r == 'e' || r == 'E' {
-		b.WriteRune(s.read())
+		s.read()
 		if r := s.peek(); r == '+' || r == '-' {
-			b.WriteRune(s.read())
+			s.read()
 		}
-		if !s.scanDecimal(b) {
-			return Token{Type: Illegal, Text: b.String()}
+		if !s.scanDecimal() {
+			return Token{Type: Illegal, Text: s.text()}
 		}
 	}
-	return Token{Type: Float, Text: b.String()}
+	return Token{Type: Float, Text: s.text()}
 }
 
-func isDigit(r rune) bool { return '0' <= r && r <= '9' }
+func isDigit(r rune) bool  { return '0' <= r && r <= '9' }
+func isOctal(r rune) bool  { return '0' <= r && r <= '7' }
+func isBinary(r rune) bool { return r == '0' || r == '1' }
+func isHex(r rune) bool {
+	return isDigit(r) || 'a' <= r && r <= 'f' || 'A' <= r && r <= 'F'
+}
+
+// isPrefix reports whether s is a prefix of a non-decimal integer
+// literal (e.g. 0x).
+func isPrefix(s string) bool {
+	return len(s) == 2 && s[0] == '0' && strings.ContainsRune("xXbBoO", rune(s[1]))
+}
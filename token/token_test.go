@@ -1,6 +1,8 @@
 package token_test
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"strings"
 	"testing"
@@ -26,9 +28,30 @@ func TestScanner(t *testing.T) {
 actually have to be a <html>
 <?phpnamespace <?php`,
 		[]token.Token{
-			{token.InlineHTML, "doesn't\nactually have to be a <html>\n<?phpnamespace <?php", pos("1:1")},
+			{token.InlineHTML, "doesn't\nactually have to be a <html>\n<?phpnamespace ", pos("1:1")},
+			{token.OpenTag, "<?php", pos("3:16")},
 			{token.EOF, "", pos("3:21")},
 		},
+	}, {
+		"echo tags",
+		`<p><?=$x?><?= 1 ?></p><?PHP
+?>`,
+		[]token.Token{
+			{token.InlineHTML, "<p>", pos("1:1")},
+			{token.EchoTag, "<?=", pos("1:4")},
+			{token.Var, "$x", pos("1:7")},
+			{token.CloseTag, "?>", pos("1:9")},
+			{token.EchoTag, "<?=", pos("1:11")},
+			{token.Whitespace, " ", pos("1:14")},
+			{token.Int, "1", pos("1:15")},
+			{token.Whitespace, " ", pos("1:16")},
+			{token.CloseTag, "?>", pos("1:17")},
+			{token.InlineHTML, "</p>", pos("1:19")},
+			{token.OpenTag, "<?PHP", pos("1:23")},
+			{token.Whitespace, "\n", pos("1:28")},
+			{token.CloseTag, "?>", pos("2:1")},
+			{token.EOF, "", pos("2:3")},
+		},
 	}, {
 		"tease opening",
 		`< <?ph  <?p <?hp nic <?php `,
@@ -48,7 +71,7 @@ actually have to be a <html>
 			{token.InlineHTML, "<html> ", pos("1:1")},
 			{token.OpenTag, "<?php", pos("1:8")},
 			{token.Whitespace, "\n\n   ", pos("1:13")},
-			{token.Ident, "echo", pos("3:4")},
+			{token.Echo, "echo", pos("3:4")},
 			{token.Whitespace, " ", pos("3:8")},
 			{token.String, `'ahoj'`, pos("3:9")},
 			{token.Semicolon, ";", pos("3:15")},
@@ -56,7 +79,7 @@ actually have to be a <html>
 			{token.InlineHTML, "\n", pos("3:18")},
 			{token.OpenTag, "<?php", pos("4:1")},
 			{token.Whitespace, " ", pos("4:6")},
-			{token.Ident, "endif", pos("4:7")},
+			{token.Endif, "endif", pos("4:7")},
 			{token.EOF, "", pos("4:12")},
 		},
 	}, {
@@ -228,6 +251,10 @@ HERE
 (<<<XX
 XX,
 )
+	<<<IN
+	  a
+
+	IN;
 `,
 		[]token.Token{
 			{token.OpenTag, "<?php", pos("1:1")},
@@ -242,8 +269,11 @@ XX,
 			{token.Comma, ",", pos("12:3")},
 			{token.Whitespace, "\n", pos("12:4")},
 			{token.Rparen, ")", pos("13:1")},
-			{token.Whitespace, "\n", pos("13:2")},
-			{token.EOF, "", pos("14:1")},
+			{token.Whitespace, "\n\t", pos("13:2")},
+			{token.String, "<<<IN\n\t  a\n\n\tIN", pos("14:2")},
+			{token.Semicolon, ";", pos("17:4")},
+			{token.Whitespace, "\n", pos("17:5")},
+			{token.EOF, "", pos("18:1")},
 		},
 	}, {
 		"nowdoc",
@@ -290,7 +320,7 @@ while enum global readonly yield from match
 			{token.Whitespace, "\n", pos("2:12")},
 			{token.Break, "Break", pos("3:1")},
 			{token.Whitespace, "\n", pos("3:6")},
-			{token.Ident, "callable", pos("4:1")},
+			{token.Callable, "callable", pos("4:1")},
 			{token.Whitespace, " ", pos("4:9")},
 			{token.Case, "case", pos("4:10")},
 			{token.Whitespace, " ", pos("4:14")},
@@ -431,6 +461,74 @@ while enum global readonly yield from match
 			{token.Whitespace, "\n", pos("4:16")},
 			{token.EOF, "", pos("5:1")},
 		},
+	}, {
+		"prefixed integers",
+		`<?php 0o17 0O7_7 0x_f 0xdead_BEEF 0b1_01 01_7 0b1__0`,
+		[]token.Token{
+			{token.OpenTag, "<?php", pos("1:1")},
+			{token.Whitespace, " ", pos("1:6")},
+			{token.Int, "0o17", pos("1:7")},
+			{token.Whitespace, " ", pos("1:11")},
+			{token.Int, "0O7_7", pos("1:12")},
+			{token.Whitespace, " ", pos("1:17")},
+			{token.Illegal, "0x_f", pos("1:18")},
+			{token.Whitespace, " ", pos("1:22")},
+			{token.Int, "0xdead_BEEF", pos("1:23")},
+			{token.Whitespace, " ", pos("1:34")},
+			{token.Int, "0b1_01", pos("1:35")},
+			{token.Whitespace, " ", pos("1:41")},
+			{token.Int, "01_7", pos("1:42")},
+			{token.Whitespace, " ", pos("1:46")},
+			{token.Illegal, "0b1__", pos("1:47")},
+			{token.Int, "0", pos("1:52")},
+			{token.EOF, "", pos("1:53")},
+		},
+	}, {
+		"casts",
+		"<?php (int)(integer)( INT\t)(Float)(double)(real)(string)(binary)(bool)(boolean)(array)(object)(unset)(int $x)(in)",
+		[]token.Token{
+			{token.OpenTag, "<?php", pos("1:1")},
+			{token.Whitespace, " ", pos("1:6")},
+			{token.IntCast, "(int)", pos("1:7")},
+			{token.IntCast, "(integer)", pos("1:12")},
+			{token.IntCast, "( INT\t)", pos("1:21")},
+			{token.FloatCast, "(Float)", pos("1:28")},
+			{token.FloatCast, "(double)", pos("1:35")},
+			{token.FloatCast, "(real)", pos("1:43")},
+			{token.StringCast, "(string)", pos("1:49")},
+			{token.StringCast, "(binary)", pos("1:57")},
+			{token.BoolCast, "(bool)", pos("1:65")},
+			{token.BoolCast, "(boolean)", pos("1:71")},
+			{token.ArrayCast, "(array)", pos("1:80")},
+			{token.ObjectCast, "(object)", pos("1:87")},
+			{token.UnsetCast, "(unset)", pos("1:95")},
+			{token.Lparen, "(", pos("1:102")},
+			{token.Ident, "int", pos("1:103")},
+			{token.Whitespace, " ", pos("1:106")},
+			{token.Var, "$x", pos("1:107")},
+			{token.Rparen, ")", pos("1:109")},
+			{token.Lparen, "(", pos("1:110")},
+			{token.Ident, "in", pos("1:111")},
+			{token.Rparen, ")", pos("1:113")},
+			{token.EOF, "", pos("1:114")},
+		},
+	}, {
+		"error suppression, bitwise not and shell exec",
+		"<?php @f();~$m;`ls \\` $dir`",
+		[]token.Token{
+			{token.OpenTag, "<?php", pos("1:1")},
+			{token.Whitespace, " ", pos("1:6")},
+			{token.At, "@", pos("1:7")},
+			{token.Ident, "f", pos("1:8")},
+			{token.Lparen, "(", pos("1:9")},
+			{token.Rparen, ")", pos("1:10")},
+			{token.Semicolon, ";", pos("1:11")},
+			{token.Tilde, "~", pos("1:12")},
+			{token.Var, "$m", pos("1:13")},
+			{token.Semicolon, ";", pos("1:15")},
+			{token.ShellExec, "`ls \\` $dir`", pos("1:16")},
+			{token.EOF, "", pos("1:28")},
+		},
 	}, {
 		"symbols",
 		`<?php = > => - ->+-+:::,`,
@@ -467,6 +565,126 @@ while enum global readonly yield from match
 			{token.Comment, "/**/", pos("1:25")},
 			{token.EOF, "", pos("1:29")},
 		},
+	}, {
+		"reserved words",
+		`<?php array list isset unset empty Exit die print eval echo var
+include include_once require require_once
+endif endwhile endfor endforeach endswitch enddeclare`,
+		[]token.Token{
+			{token.OpenTag, "<?php", pos("1:1")},
+			{token.Whitespace, " ", pos("1:6")},
+			{token.Array, "array", pos("1:7")},
+			{token.Whitespace, " ", pos("1:12")},
+			{token.List, "list", pos("1:13")},
+			{token.Whitespace, " ", pos("1:17")},
+			{token.Isset, "isset", pos("1:18")},
+			{token.Whitespace, " ", pos("1:23")},
+			{token.Unset, "unset", pos("1:24")},
+			{token.Whitespace, " ", pos("1:29")},
+			{token.Empty, "empty", pos("1:30")},
+			{token.Whitespace, " ", pos("1:35")},
+			{token.Exit, "Exit", pos("1:36")},
+			{token.Whitespace, " ", pos("1:40")},
+			{token.Exit, "die", pos("1:41")},
+			{token.Whitespace, " ", pos("1:44")},
+			{token.Print, "print", pos("1:45")},
+			{token.Whitespace, " ", pos("1:50")},
+			{token.Eval, "eval", pos("1:51")},
+			{token.Whitespace, " ", pos("1:55")},
+			{token.Echo, "echo", pos("1:56")},
+			{token.Whitespace, " ", pos("1:60")},
+			{token.VarKeyword, "var", pos("1:61")},
+			{token.Whitespace, "\n", pos("1:64")},
+			{token.Include, "include", pos("2:1")},
+			{token.Whitespace, " ", pos("2:8")},
+			{token.IncludeOnce, "include_once", pos("2:9")},
+			{token.Whitespace, " ", pos("2:21")},
+			{token.Require, "require", pos("2:22")},
+			{token.Whitespace, " ", pos("2:29")},
+			{token.RequireOnce, "require_once", pos("2:30")},
+			{token.Whitespace, "\n", pos("2:42")},
+			{token.Endif, "endif", pos("3:1")},
+			{token.Whitespace, " ", pos("3:6")},
+			{token.Endwhile, "endwhile", pos("3:7")},
+			{token.Whitespace, " ", pos("3:15")},
+			{token.Endfor, "endfor", pos("3:16")},
+			{token.Whitespace, " ", pos("3:22")},
+			{token.Endforeach, "endforeach", pos("3:23")},
+			{token.Whitespace, " ", pos("3:33")},
+			{token.Endswitch, "endswitch", pos("3:34")},
+			{token.Whitespace, " ", pos("3:43")},
+			{token.Enddeclare, "enddeclare", pos("3:44")},
+			{token.EOF, "", pos("3:54")},
+		},
+	}, {
+		"magic constants",
+		`<?php __CLASS__ __dir__ __FILE__ __FUNCTION__ __LINE__ __METHOD__ __NAMESPACE__ __TRAIT__ __FOO__`,
+		[]token.Token{
+			{token.OpenTag, "<?php", pos("1:1")},
+			{token.Whitespace, " ", pos("1:6")},
+			{token.MagicClass, "__CLASS__", pos("1:7")},
+			{token.Whitespace, " ", pos("1:16")},
+			{token.MagicDir, "__dir__", pos("1:17")},
+			{token.Whitespace, " ", pos("1:24")},
+			{token.MagicFile, "__FILE__", pos("1:25")},
+			{token.Whitespace, " ", pos("1:33")},
+			{token.MagicFunction, "__FUNCTION__", pos("1:34")},
+			{token.Whitespace, " ", pos("1:46")},
+			{token.MagicLine, "__LINE__", pos("1:47")},
+			{token.Whitespace, " ", pos("1:55")},
+			{token.MagicMethod, "__METHOD__", pos("1:56")},
+			{token.Whitespace, " ", pos("1:66")},
+			{token.MagicNamespace, "__NAMESPACE__", pos("1:67")},
+			{token.Whitespace, " ", pos("1:80")},
+			{token.MagicTrait, "__TRAIT__", pos("1:81")},
+			{token.Whitespace, " ", pos("1:90")},
+			{token.Ident, "__FOO__", pos("1:91")},
+			{token.EOF, "", pos("1:98")},
+		},
+	}, {
+		"halt compiler",
+		"<?php __HALT_COMPILER ( ) ;\x00?>\xff<?php $x\n",
+		[]token.Token{
+			{token.OpenTag, "<?php", pos("1:1")},
+			{token.Whitespace, " ", pos("1:6")},
+			{token.HaltCompiler, "__HALT_COMPILER", pos("1:7")},
+			{token.Whitespace, " ", pos("1:22")},
+			{token.Lparen, "(", pos("1:23")},
+			{token.Whitespace, " ", pos("1:24")},
+			{token.Rparen, ")", pos("1:25")},
+			{token.Whitespace, " ", pos("1:26")},
+			{token.Semicolon, ";", pos("1:27")},
+			{token.InlineHTML, "\x00?>\xff<?php $x\n", pos("1:28")},
+			{token.EOF, "", pos("2:1")},
+		},
+	}, {
+		"halt compiler with close tag",
+		"<?php __halt_compiler()?>data",
+		[]token.Token{
+			{token.OpenTag, "<?php", pos("1:1")},
+			{token.Whitespace, " ", pos("1:6")},
+			{token.HaltCompiler, "__halt_compiler", pos("1:7")},
+			{token.Lparen, "(", pos("1:22")},
+			{token.Rparen, ")", pos("1:23")},
+			{token.CloseTag, "?>", pos("1:24")},
+			{token.InlineHTML, "data", pos("1:26")},
+			{token.EOF, "", pos("1:30")},
+		},
+	}, {
+		"byte order mark",
+		"\uFEFF<?php $∂ = '\uFEFF';",
+		[]token.Token{
+			{token.BOM, "\uFEFF", pos("1:1")},
+			{token.OpenTag, "<?php", pos("1:1")},
+			{token.Whitespace, " ", pos("1:6")},
+			{token.Var, "$∂", pos("1:7")},
+			{token.Whitespace, " ", pos("1:9")},
+			{token.Assign, "=", pos("1:10")},
+			{token.Whitespace, " ", pos("1:11")},
+			{token.String, "'\uFEFF'", pos("1:12")},
+			{token.Semicolon, ";", pos("1:15")},
+			{token.EOF, "", pos("1:16")},
+		},
 	}}
 
 	for _, tt := range tests {
@@ -506,6 +724,10 @@ nic
 		"unterminated single quoted",
 		`<?php 'foooo…`,
 		"line:1:14: string not terminated",
+	}, {
+		"unterminated shell exec",
+		"<?php `ls",
+		"line:1:10: shell command not terminated",
 	}, {
 		"invalid heredoc #1",
 		`<?php <<<`,
@@ -534,6 +756,26 @@ nic
 		`<?php <<< 'HERE
 `,
 		"line:2:1: quoted heredoc identifier not terminated",
+	}, {
+		"missing heredoc identifier before newline",
+		"<?php <<<  \nHERE\nHERE;",
+		"line:1:12: missing opening heredoc identifier",
+	}, {
+		"heredoc body indented less",
+		"<?php <<<HERE\n    a\n  b\n\n    HERE;",
+		"line:3:1: invalid body indentation level (expecting an indentation level of at least 4)",
+	}, {
+		"heredoc closing indentation mixed",
+		"<?php <<<HERE\n \tHERE;",
+		"line:2:1: invalid indentation - tabs and spaces cannot be mixed",
+	}, {
+		"heredoc body indentation mixed",
+		"<?php <<<'HERE'\n\t\ta\n\t b\n\t\tHERE;",
+		"line:3:1: invalid indentation - tabs and spaces cannot be mixed",
+	}, {
+		"heredoc closing identifier prefix",
+		"<?php <<<END\n  ENDING\n  END_\n  END2",
+		"line:4:7: heredoc not terminated",
 	}}
 
 	for _, tt := range tests {
@@ -572,3 +814,193 @@ type badReader struct{}
 func (badReader) Read(p []byte) (n int, err error) {
 	return 0, fmt.Errorf("i'm fine")
 }
+
+func TestBytesScanner(t *testing.T) {
+	src := []byte("<?php echo 'Zn\xe1m'; // \xff\n?>text")
+	want := collect(token.NewScanner(bytes.NewReader(src)))
+
+	sc := token.NewBytesScanner(src)
+	copy(src, "XXXXXXXXXX") // The scanner must not be affected.
+	got := collect(sc)
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("tokens don't match: (-got +want)\n%s", diff)
+	}
+	// Invalid UTF-8 is kept verbatim.
+	if text := got[4].Text; text != "'Zn\xe1m'" {
+		t.Errorf("got %q, want invalid UTF-8 kept", text)
+	}
+}
+
+func collect(sc *token.Scanner) []token.Token {
+	var toks []token.Token
+	for {
+		tok := sc.Next()
+		toks = append(toks, tok)
+		if tok.Type == token.EOF {
+			return toks
+		}
+	}
+}
+
+func largeFile(n int) []byte {
+	var b bytes.Buffer
+	b.WriteString("<?php\n\nnamespace App\\Bench;\n\nuse Foo\\Bar as Baz;\n")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, `
+/**
+ * Class%[1]d does something useful.
+ */
+final class Class%[1]d extends Base implements \Countable
+{
+	private const LIMIT = 1_000;
+
+	public ?array $items = [];
+
+	public function count(): int
+	{
+		// Count the items.
+		return \count($this->items) + 0x%[1]x + 3.14e-2;
+	}
+
+	public function render(string $name = 'world'): string
+	{
+		$s = "Hello, {$name}!\n";
+		if ($name === null || !isset($this->items[$name])) {
+			$s .= <<<EOT
+				Item %[1]d is missing.
+				EOT;
+		}
+		return $s . 'Záznam č. %[1]d'; # non-ASCII text
+	}
+}
+`, i)
+	}
+	return b.Bytes()
+}
+
+func BenchmarkScanner(b *testing.B) {
+	src := largeFile(2000)
+	b.SetBytes(int64(len(src)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		sc := token.NewBytesScanner(src)
+		for sc.Next().Type != token.EOF {
+		}
+		if err := sc.Err(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkScannerReader(b *testing.B) {
+	src := largeFile(2000)
+	b.SetBytes(int64(len(src)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		sc := token.NewScanner(bytes.NewReader(src))
+		for sc.Next().Type != token.EOF {
+		}
+		if err := sc.Err(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	const input = "<?php $a = 'abc\n$b = 0o19_1;\n$c = <<<\n`ls\n$d;"
+	var errs []string
+	sc := token.NewScanner(strings.NewReader(input), token.WithErrorHandler(func(err *token.ScanError) {
+		errs = append(errs, err.Error())
+	}))
+	var got []string
+	for tok := sc.Next(); tok.Type != token.EOF; tok = sc.Next() {
+		if tok.Type != token.Whitespace {
+			got = append(got, tok.String())
+		}
+	}
+	want := []string{
+		`<?php`, `Var("$a")`, `=`, `Illegal("'abc")`,
+		`Var("$b")`, `=`, `Illegal("0o19_1")`, `;`,
+		`Var("$c")`, `=`, `Illegal("<<<")`,
+		"Illegal(\"`ls\")",
+		`Var("$d")`, `;`,
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("tokens don't match: (-got +want)\n%s", diff)
+	}
+	wantErrs := []string{
+		"line:1:16: string not terminated",
+		"line:2:9: invalid digit 9 in octal literal",
+		"line:3:9: missing opening heredoc identifier",
+		"line:4:4: shell command not terminated",
+	}
+	if diff := cmp.Diff(errs, wantErrs); diff != "" {
+		t.Errorf("errors don't match: (-got +want)\n%s", diff)
+	}
+	if n := sc.ErrorCount(); n != len(wantErrs) {
+		t.Errorf("got %d errors, want %d", n, len(wantErrs))
+	}
+	var se *token.ScanError
+	if err := sc.Err(); !errors.As(err, &se) || se.Pos != pos("1:16") || errors.Unwrap(err) != se.Err {
+		t.Errorf("got first error %v, want the unterminated string", err)
+	}
+}
+
+func TestClassification(t *testing.T) {
+	tests := []struct {
+		name string
+		is   func(token.Type) bool
+		yes  []token.Type
+		no   []token.Type
+	}{
+		{"IsLiteral", token.Type.IsLiteral,
+			[]token.Type{token.Ident, token.Int, token.Float, token.String, token.Var},
+			[]token.Type{token.InlineHTML, token.Comment, token.MagicDir, token.Array}},
+		{"IsAssignOp", token.Type.IsAssignOp,
+			[]token.Type{token.Assign, token.AddAssign, token.CoalesceAssign},
+			[]token.Type{token.Eq, token.DoubleArrow, token.Coalesce}},
+		{"IsComparison", token.Type.IsComparison,
+			[]token.Type{token.Lt, token.Geq, token.Neq, token.Nidentical, token.Spaceship},
+			[]token.Type{token.Assign, token.Shl, token.Instanceof}},
+		{"IsCast", token.Type.IsCast,
+			[]token.Type{token.IntCast, token.UnsetCast},
+			[]token.Type{token.Lparen, token.Int}},
+		{"IsMagicConst", token.Type.IsMagicConst,
+			[]token.Type{token.MagicClass, token.MagicTrait},
+			[]token.Type{token.Ident, token.Class}},
+	}
+	for _, tt := range tests {
+		for _, typ := range tt.yes {
+			if !tt.is(typ) {
+				t.Errorf("%s(%v) = false, want true", tt.name, typ)
+			}
+		}
+		for _, typ := range tt.no {
+			if tt.is(typ) {
+				t.Errorf("%s(%v) = true, want false", tt.name, typ)
+			}
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		ident string
+		want  token.Type
+	}{
+		{"function", token.Function},
+		{"FOREACH", token.Foreach},
+		{"__dir__", token.MagicDir},
+		{"and", token.Land},
+		{"die", token.Exit},
+		{"enum", token.Enum},
+		{"elseif", token.Ident},
+		{"foo", token.Ident},
+		{"__halt_compiler_", token.Ident},
+	}
+	for _, tt := range tests {
+		if got := token.Lookup(tt.ident); got != tt.want {
+			t.Errorf("Lookup(%q) = %v, want %v", tt.ident, got, tt.want)
+		}
+	}
+}
@@ -17,127 +17,173 @@ func _() {
 	_ = x[Int-6]
 	_ = x[Float-7]
 	_ = x[String-8]
-	_ = x[Var-9]
-	_ = x[InlineHTML-10]
-	_ = x[symbolStart-11]
-	_ = x[OpenTag-12]
-	_ = x[CloseTag-13]
-	_ = x[Dollar-14]
-	_ = x[Backslash-15]
-	_ = x[Qmark-16]
-	_ = x[Lparen-17]
-	_ = x[Rparen-18]
-	_ = x[Lbrack-19]
-	_ = x[Rbrack-20]
-	_ = x[Lbrace-21]
-	_ = x[Rbrace-22]
-	_ = x[Add-23]
-	_ = x[Sub-24]
-	_ = x[Mul-25]
-	_ = x[Quo-26]
-	_ = x[Rem-27]
-	_ = x[Pow-28]
-	_ = x[And-29]
-	_ = x[Or-30]
-	_ = x[Xor-31]
-	_ = x[Shl-32]
-	_ = x[Shr-33]
-	_ = x[Concat-34]
-	_ = x[Coalesce-35]
-	_ = x[AddAssign-36]
-	_ = x[SubAssign-37]
-	_ = x[MulAssign-38]
-	_ = x[QuoAssign-39]
-	_ = x[RemAssign-40]
-	_ = x[PowAssign-41]
-	_ = x[AndAssign-42]
-	_ = x[OrAssign-43]
-	_ = x[XorAssign-44]
-	_ = x[ShlAssign-45]
-	_ = x[ShrAssign-46]
-	_ = x[ConcatAssign-47]
-	_ = x[CoalesceAssign-48]
-	_ = x[Land-49]
-	_ = x[Lor-50]
-	_ = x[Inc-51]
-	_ = x[Dec-52]
-	_ = x[Assign-53]
-	_ = x[Not-54]
-	_ = x[Lt-55]
-	_ = x[Gt-56]
-	_ = x[Leq-57]
-	_ = x[Geq-58]
-	_ = x[Eq-59]
-	_ = x[Neq-60]
-	_ = x[Identical-61]
-	_ = x[Nidentical-62]
-	_ = x[Comma-63]
-	_ = x[Colon-64]
-	_ = x[DoubleColon-65]
-	_ = x[Semicolon-66]
-	_ = x[Ellipsis-67]
-	_ = x[Arrow-68]
-	_ = x[QmarkArrow-69]
-	_ = x[DoubleArrow-70]
-	_ = x[Spaceship-71]
-	_ = x[symbolEnd-72]
-	_ = x[keywordStart-73]
-	_ = x[Abstract-74]
-	_ = x[As-75]
-	_ = x[Break-76]
-	_ = x[Case-77]
-	_ = x[Catch-78]
-	_ = x[Class-79]
-	_ = x[Clone-80]
-	_ = x[Const-81]
-	_ = x[Continue-82]
-	_ = x[Declare-83]
-	_ = x[Default-84]
-	_ = x[Do-85]
-	_ = x[Else-86]
-	_ = x[Enum-87]
-	_ = x[Extends-88]
-	_ = x[Final-89]
-	_ = x[Finally-90]
-	_ = x[Fn-91]
-	_ = x[For-92]
-	_ = x[Foreach-93]
-	_ = x[From-94]
-	_ = x[Function-95]
-	_ = x[Global-96]
-	_ = x[Goto-97]
-	_ = x[If-98]
-	_ = x[Implements-99]
-	_ = x[Instanceof-100]
-	_ = x[Insteadof-101]
-	_ = x[Interface-102]
-	_ = x[Match-103]
-	_ = x[Namespace-104]
-	_ = x[New-105]
-	_ = x[Private-106]
-	_ = x[Protected-107]
-	_ = x[Public-108]
-	_ = x[Readonly-109]
-	_ = x[Return-110]
-	_ = x[Static-111]
-	_ = x[Switch-112]
-	_ = x[Throw-113]
-	_ = x[Trait-114]
-	_ = x[Try-115]
-	_ = x[Use-116]
-	_ = x[Lxor-117]
-	_ = x[While-118]
-	_ = x[Yield-119]
-	_ = x[keywordEnd-120]
+	_ = x[ShellExec-9]
+	_ = x[Var-10]
+	_ = x[InlineHTML-11]
+	_ = x[BOM-12]
+	_ = x[symbolStart-13]
+	_ = x[OpenTag-14]
+	_ = x[EchoTag-15]
+	_ = x[CloseTag-16]
+	_ = x[Dollar-17]
+	_ = x[Backslash-18]
+	_ = x[Qmark-19]
+	_ = x[Lparen-20]
+	_ = x[Rparen-21]
+	_ = x[Lbrack-22]
+	_ = x[Rbrack-23]
+	_ = x[Lbrace-24]
+	_ = x[Rbrace-25]
+	_ = x[AttrStart-26]
+	_ = x[Add-27]
+	_ = x[Sub-28]
+	_ = x[Mul-29]
+	_ = x[Quo-30]
+	_ = x[Rem-31]
+	_ = x[Pow-32]
+	_ = x[And-33]
+	_ = x[Or-34]
+	_ = x[Xor-35]
+	_ = x[Shl-36]
+	_ = x[Shr-37]
+	_ = x[Concat-38]
+	_ = x[Coalesce-39]
+	_ = x[AddAssign-40]
+	_ = x[SubAssign-41]
+	_ = x[MulAssign-42]
+	_ = x[QuoAssign-43]
+	_ = x[RemAssign-44]
+	_ = x[PowAssign-45]
+	_ = x[AndAssign-46]
+	_ = x[OrAssign-47]
+	_ = x[XorAssign-48]
+	_ = x[ShlAssign-49]
+	_ = x[ShrAssign-50]
+	_ = x[ConcatAssign-51]
+	_ = x[CoalesceAssign-52]
+	_ = x[Land-53]
+	_ = x[Lor-54]
+	_ = x[Inc-55]
+	_ = x[Dec-56]
+	_ = x[Assign-57]
+	_ = x[Not-58]
+	_ = x[Lt-59]
+	_ = x[Gt-60]
+	_ = x[Leq-61]
+	_ = x[Geq-62]
+	_ = x[Eq-63]
+	_ = x[Neq-64]
+	_ = x[Identical-65]
+	_ = x[Nidentical-66]
+	_ = x[Comma-67]
+	_ = x[Colon-68]
+	_ = x[DoubleColon-69]
+	_ = x[Semicolon-70]
+	_ = x[Ellipsis-71]
+	_ = x[Arrow-72]
+	_ = x[QmarkArrow-73]
+	_ = x[DoubleArrow-74]
+	_ = x[Spaceship-75]
+	_ = x[At-76]
+	_ = x[Tilde-77]
+	_ = x[IntCast-78]
+	_ = x[FloatCast-79]
+	_ = x[StringCast-80]
+	_ = x[BoolCast-81]
+	_ = x[ArrayCast-82]
+	_ = x[ObjectCast-83]
+	_ = x[UnsetCast-84]
+	_ = x[symbolEnd-85]
+	_ = x[keywordStart-86]
+	_ = x[Abstract-87]
+	_ = x[Array-88]
+	_ = x[As-89]
+	_ = x[Break-90]
+	_ = x[Callable-91]
+	_ = x[Case-92]
+	_ = x[Catch-93]
+	_ = x[Class-94]
+	_ = x[Clone-95]
+	_ = x[Const-96]
+	_ = x[Continue-97]
+	_ = x[Declare-98]
+	_ = x[Default-99]
+	_ = x[Do-100]
+	_ = x[Echo-101]
+	_ = x[Else-102]
+	_ = x[Empty-103]
+	_ = x[Enddeclare-104]
+	_ = x[Endfor-105]
+	_ = x[Endforeach-106]
+	_ = x[Endif-107]
+	_ = x[Endswitch-108]
+	_ = x[Endwhile-109]
+	_ = x[Enum-110]
+	_ = x[Eval-111]
+	_ = x[Exit-112]
+	_ = x[Extends-113]
+	_ = x[Final-114]
+	_ = x[Finally-115]
+	_ = x[Fn-116]
+	_ = x[For-117]
+	_ = x[Foreach-118]
+	_ = x[From-119]
+	_ = x[Function-120]
+	_ = x[Global-121]
+	_ = x[Goto-122]
+	_ = x[HaltCompiler-123]
+	_ = x[If-124]
+	_ = x[Implements-125]
+	_ = x[Include-126]
+	_ = x[IncludeOnce-127]
+	_ = x[Instanceof-128]
+	_ = x[Insteadof-129]
+	_ = x[Interface-130]
+	_ = x[Isset-131]
+	_ = x[List-132]
+	_ = x[Match-133]
+	_ = x[Namespace-134]
+	_ = x[New-135]
+	_ = x[Print-136]
+	_ = x[Private-137]
+	_ = x[Protected-138]
+	_ = x[Public-139]
+	_ = x[Readonly-140]
+	_ = x[Require-141]
+	_ = x[RequireOnce-142]
+	_ = x[Return-143]
+	_ = x[Static-144]
+	_ = x[Switch-145]
+	_ = x[Throw-146]
+	_ = x[Trait-147]
+	_ = x[Try-148]
+	_ = x[Unset-149]
+	_ = x[Use-150]
+	_ = x[VarKeyword-151]
+	_ = x[Lxor-152]
+	_ = x[While-153]
+	_ = x[Yield-154]
+	_ = x[keywordEnd-155]
+	_ = x[magicConstStart-156]
+	_ = x[MagicClass-157]
+	_ = x[MagicDir-158]
+	_ = x[MagicFile-159]
+	_ = x[MagicFunction-160]
+	_ = x[MagicLine-161]
+	_ = x[MagicMethod-162]
+	_ = x[MagicNamespace-163]
+	_ = x[MagicTrait-164]
+	_ = x[magicConstEnd-165]
 }
 
-const _Type_name = "IllegalEOFWhitespaceCommentDocCommentIdentIntFloatStringVarInlineHTMLsymbolStart<?php?>$\\?()[]{}+-*/%**&|^<<>>.??+=-=*=/=%=**=&=|=^=<<=>>=.=??=&&||++--=!<><=>===!====!==,:::;...->?->=><=>symbolEndkeywordStartabstractasbreakcasecatchclasscloneconstcontinuedeclaredefaultdoelseenumextendsfinalfinallyfnforforeachfromfunctionglobalgotoifimplementsinstanceofinsteadofinterfacematchnamespacenewprivateprotectedpublicreadonlyreturnstaticswitchthrowtraittryusexorwhileyieldkeywordEnd"
+const _Type_name = "IllegalEOFWhitespaceCommentDocCommentIdentIntFloatString`...`VarInlineHTMLbyte order marksymbolStart<?php<?=?>$\\?()[]{}#[+-*/%**&|^<<>>.??+=-=*=/=%=**=&=|=^=<<=>>=.=??=&&||++--=!<><=>===!====!==,:::;...->?->=><=>@~(int)(float)(string)(bool)(array)(object)(unset)symbolEndkeywordStartabstractarrayasbreakcallablecasecatchclasscloneconstcontinuedeclaredefaultdoechoelseemptyenddeclareendforendforeachendifendswitchendwhileenumevalexitextendsfinalfinallyfnforforeachfromfunctionglobalgoto__halt_compilerifimplementsincludeinclude_onceinstanceofinsteadofinterfaceissetlistmatchnamespacenewprintprivateprotectedpublicreadonlyrequirerequire_oncereturnstaticswitchthrowtraittryunsetusevarxorwhileyieldkeywordEndmagicConstStart__CLASS____DIR____FILE____FUNCTION____LINE____METHOD____NAMESPACE____TRAIT__magicConstEnd"
 
-var _Type_index = [...]uint16{0, 7, 10, 20, 27, 37, 42, 45, 50, 56, 59, 69, 80, 85, 87, 88, 89, 90, 91, 92, 93, 94, 95, 96, 97, 98, 99, 100, 101, 103, 104, 105, 106, 108, 110, 111, 113, 115, 117, 119, 121, 123, 126, 128, 130, 132, 135, 138, 140, 143, 145, 147, 149, 151, 152, 153, 154, 155, 157, 159, 161, 163, 166, 169, 170, 171, 173, 174, 177, 179, 182, 184, 187, 196, 208, 216, 218, 223, 227, 232, 237, 242, 247, 255, 262, 269, 271, 275, 279, 286, 291, 298, 300, 303, 310, 314, 322, 328, 332, 334, 344, 354, 363, 372, 377, 386, 389, 396, 405, 411, 419, 425, 431, 437, 442, 447, 450, 453, 456, 461, 466, 476}
+var _Type_index = [...]uint16{0, 7, 10, 20, 27, 37, 42, 45, 50, 56, 61, 64, 74, 89, 100, 105, 108, 110, 111, 112, 113, 114, 115, 116, 117, 118, 119, 121, 122, 123, 124, 125, 126, 128, 129, 130, 131, 133, 135, 136, 138, 140, 142, 144, 146, 148, 151, 153, 155, 157, 160, 163, 165, 168, 170, 172, 174, 176, 177, 178, 179, 180, 182, 184, 186, 188, 191, 194, 195, 196, 198, 199, 202, 204, 207, 209, 212, 213, 214, 219, 226, 234, 240, 247, 255, 262, 271, 283, 291, 296, 298, 303, 311, 315, 320, 325, 330, 335, 343, 350, 357, 359, 363, 367, 372, 382, 388, 398, 403, 412, 420, 424, 428, 432, 439, 444, 451, 453, 456, 463, 467, 475, 481, 485, 500, 502, 512, 519, 531, 541, 550, 559, 564, 568, 573, 582, 585, 590, 597, 606, 612, 620, 627, 639, 645, 651, 657, 662, 667, 670, 675, 678, 681, 684, 689, 694, 704, 719, 728, 735, 743, 755, 763, 773, 786, 795, 808}
 
 func (i Type) String() string {
-	if i >= Type(len(_Type_index)-1) {
+	idx := int(i) - 0
+	if i < 0 || idx >= len(_Type_index)-1 {
 		return "Type(" + strconv.FormatInt(int64(i), 10) + ")"
 	}
-	return _Type_name[_Type_index[i]:_Type_index[i+1]]
+	return _Type_name[_Type_index[idx]:_Type_index[idx+1]]
 }
@@ -0,0 +1,149 @@
+package token
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A Version represents a PHP version. Keywords introduced in a later
+// version than the one a Scanner follows are scanned as identifiers,
+// and syntax introduced later is reported as an error.
+type Version uint
+
+const (
+	PHP70 Version = 70 + iota
+	PHP71
+	PHP72
+	PHP73
+	PHP74
+)
+
+const (
+	PHP80 Version = 80 + iota
+	PHP81
+	PHP82
+	PHP83
+	PHP84
+)
+
+// Latest is the latest supported version. Scanners follow it unless
+// told otherwise.
+const Latest = PHP84
+
+func (v Version) String() string { return fmt.Sprintf("%d.%d", v/10, v%10) }
+
+// ParseVersion parses a version in the form major.minor (e.g. 7.4).
+func ParseVersion(s string) (Version, error) {
+	var major, minor uint
+	if n, err := fmt.Sscanf(s, "%d.%d", &major, &minor); err != nil || n != 2 || minor > 9 {
+		return 0, fmt.Errorf("invalid PHP version %q", s)
+	}
+	v := Version(major*10 + minor)
+	if s != v.String() || !v.valid() {
+		return 0, fmt.Errorf("unsupported PHP version %s", s)
+	}
+	return v, nil
+}
+
+func (v Version) valid() bool {
+	return PHP70 <= v && v <= PHP74 || PHP80 <= v && v <= PHP84
+}
+
+// An Option configures a Scanner.
+type Option func(*Scanner)
+
+// WithVersion makes the Scanner follow the PHP version v. It panics if
+// v is not supported.
+func WithVersion(v Version) Option {
+	if !v.valid() {
+		panic(fmt.Sprintf("unsupported PHP version %v", v))
+	}
+	return func(s *Scanner) { s.version = v }
+}
+
+// Version returns the PHP version s follows.
+func (s *Scanner) Version() Version { return s.version }
+
+// keywordVersions maps keywords to the versions that introduced them.
+// In earlier versions, they are ordinary identifiers.
+var keywordVersions = map[Type]Version{
+	Fn:       PHP74,
+	Match:    PHP80,
+	Enum:     PHP81,
+	Readonly: PHP81,
+}
+
+// isKeyword reports whether typ, a keyword type, is a keyword in the
+// current context. Contextual keywords might be identifiers.
+func (s *Scanner) isKeyword(typ Type) bool {
+	if v, ok := keywordVersions[typ]; ok && s.version < v {
+		return false
+	}
+	switch typ {
+	case Enum:
+		return s.isEnumDecl()
+	case From:
+		// From is only a keyword in yield from.
+		return s.prev == Yield
+	}
+	return true
+}
+
+// isEnumDecl reports whether the enum keyword that has just been
+// scanned starts an enum declaration, i.e. whether it is followed by
+// whitespace and a name other than extends or implements. Otherwise,
+// enum is an ordinary identifier (e.g. a class or a function name).
+func (s *Scanner) isEnumDecl() bool {
+	buf := s.src[s.off:]
+	i := 0
+	for i < len(buf) && isSpace(buf[i]) {
+		i++
+	}
+	j := i
+	for j < len(buf) && (isIdentStart(buf[j]) || isDigit(rune(buf[j]))) {
+		j++
+	}
+	if i == 0 || j == i || !isIdentStart(buf[i]) {
+		return false
+	}
+	switch strings.ToLower(buf[i:j]) {
+	case "extends", "implements":
+		return false
+	}
+	return true
+}
+
+// MinVersion returns the minimum version that supports tok, along with
+// a description of the syntax. If all versions support tok, the returned
+// version is 0.
+func MinVersion(tok Token) (Version, string) {
+	switch tok.Type {
+	case Fn:
+		return PHP74, "arrow function"
+	case Match:
+		return PHP80, "match expression"
+	case Enum:
+		return PHP81, "enumeration"
+	case Readonly:
+		return PHP81, "readonly property"
+	case CoalesceAssign:
+		return PHP74, "null coalescing assignment operator"
+	case QmarkArrow:
+		return PHP80, "nullsafe operator"
+	case AttrStart:
+		return PHP80, "attribute"
+	case Int, Float:
+		if strings.HasPrefix(tok.Text, "0o") || strings.HasPrefix(tok.Text, "0O") {
+			return PHP81, "explicit octal notation"
+		}
+		if strings.ContainsRune(tok.Text, '_') {
+			return PHP74, "numeric literal separator"
+		}
+	case String:
+		i := strings.LastIndexByte(tok.Text, '\n')
+		if strings.HasPrefix(tok.Text, "<<<") && i >= 0 && i+1 < len(tok.Text) && isSpace(tok.Text[i+1]) {
+			return PHP73, "indented heredoc closing identifier"
+		}
+	}
+	return 0, ""
+}
@@ -0,0 +1,109 @@
+package token_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"mibk.dev/php/token"
+)
+
+func TestVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		version token.Version
+		input   string
+		want    []token.Type
+	}{{
+		"legacy identifiers",
+		token.PHP70,
+		`<?php enum match readonly fn from`,
+		[]token.Type{token.Ident, token.Ident, token.Ident, token.Ident, token.Ident},
+	}, {
+		"arrow functions",
+		token.PHP74,
+		`<?php fn match`,
+		[]token.Type{token.Fn, token.Ident},
+	}, {
+		"latest keywords",
+		token.Latest,
+		`<?php enum Suit match readonly fn yield from`,
+		[]token.Type{token.Enum, token.Ident, token.Match, token.Readonly, token.Fn, token.Yield, token.From},
+	}, {
+		"contextual enum",
+		token.Latest,
+		`<?php enum_exists(Enum::X) enum extends enum
+implements enum/* */`,
+		[]token.Type{
+			token.Ident, token.Lparen, token.Ident, token.DoubleColon, token.Ident, token.Rparen,
+			token.Ident, token.Extends, token.Ident, token.Implements, token.Ident, token.Comment,
+		},
+	}, {
+		"contextual from",
+		token.Latest,
+		`<?php from(yield /* */ from)`,
+		[]token.Type{token.Ident, token.Lparen, token.Yield, token.Comment, token.From, token.Rparen},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := token.NewScanner(strings.NewReader(tt.input), token.WithVersion(tt.version))
+			if sc.Version() != tt.version {
+				t.Fatalf("got version %v, want %v", sc.Version(), tt.version)
+			}
+
+			var got []token.Type
+			for tok := sc.Next(); tok.Type != token.EOF; tok = sc.Next() {
+				if tok.Type != token.OpenTag && tok.Type != token.Whitespace {
+					got = append(got, tok.Type)
+				}
+			}
+			if err := sc.Err(); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("token types don't match: (-got +want)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestVersionErrors(t *testing.T) {
+	tests := []struct {
+		version token.Version
+		input   string
+		wantErr string
+	}{
+		{token.PHP73, "<?php $a ??= 1;", "line:1:10: null coalescing assignment operator requires PHP 7.4"},
+		{token.PHP74, "<?php $a?->b;", "line:1:9: nullsafe operator requires PHP 8.0"},
+		{token.PHP73, "<?php 1_000;", "line:1:7: numeric literal separator requires PHP 7.4"},
+		{token.PHP73, "<?php 1_0.5;", "line:1:7: numeric literal separator requires PHP 7.4"},
+		{token.PHP80, "<?php 0o17;", "line:1:7: explicit octal notation requires PHP 8.1"},
+		{token.PHP72, "<?php <<<X\n  a\n  X;", "line:1:7: indented heredoc closing identifier requires PHP 7.3"},
+		{token.PHP72, "<?php <<<X\na\nX;", "<nil>"},
+		{token.PHP70, "<?php $a ?? 017;", "<nil>"},
+	}
+
+	for _, tt := range tests {
+		sc := token.NewScanner(strings.NewReader(tt.input), token.WithVersion(tt.version))
+		for sc.Next().Type != token.EOF {
+		}
+		errStr := "<nil>"
+		if err := sc.Err(); err != nil {
+			errStr = err.Error()
+		}
+		if errStr != tt.wantErr {
+			t.Errorf("%s (PHP %v):\n got %s\nwant %s", tt.input, tt.version, errStr, tt.wantErr)
+		}
+	}
+}
+
+func TestUnsupportedVersion(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("WithVersion(7.5) did not panic")
+		}
+	}()
+	token.WithVersion(75)
+}